@@ -2,26 +2,89 @@ package main
 
 import (
 	"bufio"
+	"crypto/tls"
+	"errors"
 	"flag"
 	"fmt"
 	"net"
 	"os"
 	"strings"
 	"time"
+
+	"messenger-protocol"
 )
 
 // ============================================================
-// GLOBAL ENCRYPTION KEY
+// PROTOCOL HANDSHAKE
 // ============================================================
 
-// encryptionKey stores the room's encryption key (Base64)
-// This is set when creating or joining a room
-var encryptionKey string
+// clientCapabilities lists the optional features this client supports
+var clientCapabilities = []string{protocol.CapHistory, protocol.CapHeartbeat, protocol.CapWho, protocol.CapNick}
+
+// historyPending counts backlog messages still to be printed
+// (announced by the server in the join ack)
+//
+// Like roomMembers, the history counters are used by the receiving
+// goroutine, and by /join only while that goroutine is parked (join.go).
+var historyPending int
+
+// historyOffline is true when the backlog is our offline queue
+// in a persistent room; historyDropped counts messages lost from it
+var (
+	historyOffline bool
+	historyDropped int
+)
+
+// defaultMaxMessage is the largest encrypted chat body older servers
+// relay (newer ones say so in their hello)
+const defaultMaxMessage = 32 * 1024
+
+// handshake sends our hello and waits for the server's answer
+//
+// Returns the server's hello — the capabilities both sides support,
+// its code format and message limit — or the server's *protocol.Error
+// if it refused us (e.g. incompatible version).
+func handshake(conn net.Conn, reader *bufio.Reader, username string) (protocol.Hello, error) {
+	err := protocol.Send(conn, protocol.TypeHello, protocol.Hello{
+		Version:      protocol.Version,
+		MinVersion:   protocol.MinVersion,
+		Capabilities: clientCapabilities,
+		Username:     username,
+		PublicKey:    publicKey(),
+	})
+	if err != nil {
+		return protocol.Hello{}, err
+	}
+
+	var reply protocol.Hello
+	if err := protocol.Expect(reader, protocol.TypeHello, &reply); err != nil {
+		return protocol.Hello{}, err
+	}
+
+	// Double-check the server picked a version we can speak
+	if reply.Version < protocol.MinVersion || reply.Version > protocol.Version {
+		return protocol.Hello{}, &protocol.Error{
+			Code: protocol.ErrIncompatibleVersion,
+			Message: fmt.Sprintf("server chose protocol v%d, client supports v%d-v%d",
+				reply.Version, protocol.MinVersion, protocol.Version),
+		}
+	}
+
+	return reply, nil
+}
+
+// codeFormat describes the server's room codes, e.g. "8 digits"
+func codeFormat(hello protocol.Hello) string {
+	if hello.CodeFormat == "" {
+		return "room code"
+	}
+	return hello.CodeFormat
+}
 
 func errCheck(err error) {
 	if err != nil {
-		fmt.Println("Error:", err)
-		os.Exit(1) // 1 = ошибка, 0 = успех
+		fmt.Fprintln(term, "Error:", err)
+		exit(1) // 1 = ошибка, 0 = успех (terminal.go)
 	}
 }
 func checkServer(address string) bool {
@@ -47,8 +110,27 @@ func main() {
 	//   ""    — значение по умолчанию (пустая строка)
 	//   "..." — описание для --help
 	flagIP := flag.String("ip", "", "Server IP address (e.g. 192.168.1.100:8080)")
+	flagTLS := flag.Bool("tls", false, "Connect over TLS (pins the server certificate on first use)")
+	flagCA := flag.String("ca", "", "CA certificate file (PEM) to verify the server, implies -tls")
+	flagKnownHosts := flag.String("known-hosts", defaultKnownHostsFile(), "File with pinned server certificates")
+	flagOwnerToken := flag.String("owner-token", "", "Owner token of a room you created (to manage it after rejoining)")
+	flagMemberToken := flag.String("member-token", "", "Member token of a persistent room (to get the messages sent while you were away)")
+	flag.DurationVar(&pingInterval, "ping-interval", pingInterval, "How often to ping the server")
+	flag.DurationVar(&idleTimeout, "idle-timeout", idleTimeout, "Give up on the server after this long without any data")
+	flag.BoolVar(&autoReconnect, "reconnect", autoReconnect, "Reconnect to the room automatically if the connection drops")
+	flag.BoolVar(&typingEnabled, "typing", typingEnabled, "Show when others are typing and tell them when you are")
 	flag.Parse() // Читает аргументы командной строки
 
+	if typingEnabled {
+		clientCapabilities = append(clientCapabilities, protocol.CapTyping)
+	}
+
+	// Key pair for private messages (direct.go)
+	if keys, err := newKeyPair(); err == nil {
+		myKeys = keys
+		clientCapabilities = append(clientCapabilities, protocol.CapDirect)
+	}
+
 	// Получаем IP: сначала из флага, если нет — из переменной окружения
 	var serverIP string
 	if *flagIP != "" {
@@ -64,19 +146,19 @@ func main() {
 	// ==========================================
 
 	if serverIP == "" {
-		fmt.Println("Error: Server IP is required")
-		fmt.Println("")
-		fmt.Println("Usage:")
-		fmt.Println("  Method 1: Flag")
-		fmt.Println("    go run client.go -ip=192.168.1.100:8080")
-		fmt.Println("")
-		fmt.Println("  Method 2: Environment variable")
-		fmt.Println("    export SERVER_IP=192.168.1.100:8080")
-		fmt.Println("    go run client.go")
-		fmt.Println("")
-		fmt.Println("Examples:")
-		fmt.Println("  go run client.go -ip=192.168.1.100:8080")
-		fmt.Println("  export SERVER_IP=100.64.0.5:8080 && go run client.go")
+		fmt.Fprintln(term, "Error: Server IP is required")
+		fmt.Fprintln(term, "")
+		fmt.Fprintln(term, "Usage:")
+		fmt.Fprintln(term, "  Method 1: Flag")
+		fmt.Fprintln(term, "    go run client.go -ip=192.168.1.100:8080")
+		fmt.Fprintln(term, "")
+		fmt.Fprintln(term, "  Method 2: Environment variable")
+		fmt.Fprintln(term, "    export SERVER_IP=192.168.1.100:8080")
+		fmt.Fprintln(term, "    go run client.go")
+		fmt.Fprintln(term, "")
+		fmt.Fprintln(term, "Examples:")
+		fmt.Fprintln(term, "  go run client.go -ip=192.168.1.100:8080")
+		fmt.Fprintln(term, "  export SERVER_IP=100.64.0.5:8080 && go run client.go")
 		os.Exit(1)
 	}
 
@@ -89,18 +171,26 @@ func main() {
 	// ШАГ 3: Проверяем доступность сервера
 	// ==========================================
 
-	fmt.Println("Checking server", serverIP, "...")
+	fmt.Fprintln(term, "Checking server", serverIP, "...")
 	if !checkServer(serverIP) {
-		fmt.Println("Error: Cannot reach server at", serverIP)
-		fmt.Println("")
-		fmt.Println("Check:")
-		fmt.Println("  1. Is server running?")
-		fmt.Println("  2. Is IP address correct?")
-		fmt.Println("  3. Are you on the same network?")
+		fmt.Fprintln(term, "Error: Cannot reach server at", serverIP)
+		fmt.Fprintln(term, "")
+		fmt.Fprintln(term, "Check:")
+		fmt.Fprintln(term, "  1. Is server running?")
+		fmt.Fprintln(term, "  2. Is IP address correct?")
+		fmt.Fprintln(term, "  3. Are you on the same network?")
 		os.Exit(1)
 	}
-	fmt.Println("Server is reachable!")
-	fmt.Println("")
+	fmt.Fprintln(term, "Server is reachable!")
+	fmt.Fprintln(term, "")
+
+	var tlsConfig *tls.Config
+	if *flagTLS || *flagCA != "" {
+		var err error
+		tlsConfig, err = newTLSConfig(serverIP, *flagCA, *flagKnownHosts)
+		errCheck(err)
+		clientCapabilities = append(clientCapabilities, protocol.CapTLS)
+	}
 
 	// ==========================================
 	// ШАГ 4: Красивое приветствие
@@ -108,50 +198,33 @@ func main() {
 
 	inputReader := bufio.NewReader(os.Stdin)
 
-	fmt.Println("╔════════════════════════════════════╗")
-	fmt.Println("║          SIMPLE MESSENGER          ║")
-	fmt.Println("╚════════════════════════════════════╝")
-	fmt.Println("")
+	fmt.Fprintln(term, "╔════════════════════════════════════╗")
+	fmt.Fprintln(term, "║          SIMPLE MESSENGER          ║")
+	fmt.Fprintln(term, "╚════════════════════════════════════╝")
+	fmt.Fprintln(term, "")
 
 	// ==========================================
 	// ШАГ 5: Ввод username
 	// ==========================================
 
-	var username string
-
-	for {
-		fmt.Print("Enter your username: ")
-		var err error
-		username, err = inputReader.ReadString('\n')
-		errCheck(err)
-		username = strings.TrimSpace(username)
-
-		if username == "" {
-			fmt.Println("Warning: Username cannot be empty! Try again.")
+	username := askUsername(inputReader)
 
-		} else if len(username) > 10 {
-			fmt.Println("Meh tf is that username should be maximum 10 chars")
-
-		} else {
-			fmt.Println("Accepted")
-			break
-		}
-	}
-
-	fmt.Println("")
+	fmt.Fprintln(term, "")
 
 	// ==========================================
 	// ШАГ 6: Меню — create или connect
 	// ==========================================
 
 	var command string
+	var persistent, knock bool
+	var secret string
 
 	for {
-		fmt.Println("What do you want to do?")
-		fmt.Println("  [1] create  - Create a new room")
-		fmt.Println("  [2] connect - Join existing room")
-		fmt.Println("")
-		fmt.Print("Your choice: ")
+		fmt.Fprintln(term, "What do you want to do?")
+		fmt.Fprintln(term, "  [1] create  - Create a new room")
+		fmt.Fprintln(term, "  [2] connect - Join existing room")
+		fmt.Fprintln(term, "")
+		fmt.Fprint(term, "Your choice: ")
 
 		choice, err := inputReader.ReadString('\n')
 		errCheck(err)
@@ -159,26 +232,29 @@ func main() {
 
 		if choice == "1" || choice == "create" {
 			command = "create"
+			persistent = askYesNo(inputReader, "Keep the room when everyone leaves? [y/N]: ")
+			secret = askLimited(inputReader, "Room password (empty for none): ", "Password", protocol.MaxSecretLength)
+			knock = askYesNo(inputReader, "Approve every new member yourself? [y/N]: ")
 			break
 		} else if choice == "2" || choice == "connect" {
 			command = "connect"
 			break
 		} else {
-			fmt.Println("Warning: Invalid choice! Please enter 1 or 2.")
+			fmt.Fprintln(term, "Warning: Invalid choice! Please enter 1 or 2.")
 		}
 	}
 
-	fmt.Println("")
+	fmt.Fprintln(term, "")
 
 	// ==========================================
 	// ШАГ 7: Подключаемся к серверу
 	// ==========================================
 
-	fmt.Println("Connecting to", serverIP, "...")
+	fmt.Fprintln(term, "Connecting to", serverIP, "...")
 
-	conn, err := net.Dial("tcp", serverIP)
+	conn, err := dialServer(serverIP, tlsConfig)
 	if err != nil {
-		fmt.Println("Error: Connection failed:", err)
+		fmt.Fprintln(term, "Error: Connection failed:", err)
 		os.Exit(1)
 	}
 	defer conn.Close()
@@ -186,156 +262,148 @@ func main() {
 	serverReader := bufio.NewReader(conn)
 
 	// ==========================================
-	// ШАГ 8: Отправляем username и команду
+	// ШАГ 8: Handshake — версия протокола и возможности
 	// ==========================================
 
-	conn.Write([]byte(username + "\n"))
-	conn.Write([]byte(command + "\n"))
+	hello, err := handshake(conn, serverReader, username)
+	if err != nil {
+		var protoErr *protocol.Error
+		if errors.As(err, &protoErr) && protoErr.Code == protocol.ErrIncompatibleVersion {
+			fmt.Fprintln(term, "Error: This client is not compatible with the server.")
+			fmt.Fprintln(term, "  ", protoErr.Message)
+			fmt.Fprintln(term, "  Update the client (or ask the operator to update the server).")
+			os.Exit(1)
+		}
+		fmt.Fprintln(term, "Error: Handshake failed:", err)
+		os.Exit(1)
+	}
 
 	// ==========================================
 	// ШАГ 9: Обрабатываем ответ сервера
 	// ==========================================
 
+	// Everything needed to reconnect later (reconnect.go)
+	sess := &session{
+		address:   serverIP,
+		tlsConfig: tlsConfig,
+		username:  username,
+		input:     inputReader,
+		conn:      conn,
+		reader:    serverReader,
+		hello:     hello,
+		leaving:   make(chan struct{}),
+	}
+
 	if command == "create" {
-		response, err := serverReader.ReadString('\n')
+		err = protocol.Send(conn, protocol.TypeCreate, protocol.Create{
+			Persistent: persistent,
+			Secret:     secret,
+			Knock:      knock,
+		})
 		errCheck(err)
-		response = strings.TrimSpace(response)
-
-		if strings.HasPrefix(response, "CODE:") {
-			roomCode := strings.TrimPrefix(response, "CODE:")
 
-			// Generate encryption key for this room
-			encryptionKey, err = GenerateEncryptionKey()
-			if err != nil {
-				fmt.Println("Error generating encryption key:", err)
-				return
-			}
-
-			fmt.Println("╔══════════════════════════════════════════════════════╗")
-			fmt.Println("║              ROOM CREATED! (ENCRYPTED)               ║")
-			fmt.Println("╠══════════════════════════════════════════════════════╣")
-			fmt.Printf("║   Room Code: %-40s║\n", roomCode)
-			fmt.Println("╠══════════════════════════════════════════════════════╣")
-			fmt.Println("║   ENCRYPTION KEY (share SECURELY with friends!):     ║")
-			fmt.Printf("║   %s   ║\n", encryptionKey)
-			fmt.Println("╠══════════════════════════════════════════════════════╣")
-			fmt.Println("║   WARNING: Anyone with this key can read messages!   ║")
-			fmt.Println("║   Share via secure channel (in person, Signal, etc)  ║")
-			fmt.Println("╚══════════════════════════════════════════════════════╝")
-		} else {
-			fmt.Println("Unexpected response:", response)
+		ack, err := sess.waitForAck(serverReader)
+		if err != nil {
+			fmt.Fprintln(term, "Error:", err)
 			return
 		}
+		roomCode := ack.Room
+		roomMembers = ack.Members
+		sess.join = protocol.Join{
+			Code:        roomCode,
+			Secret:      secret,
+			OwnerToken:  ack.OwnerToken,
+			ResumeToken: ack.ResumeToken,
+			MemberToken: ack.MemberToken,
+		}
 
-	} else if command == "connect" {
-		// Ввод кода комнаты (с повтором при ошибке)
-		var roomCode string
-
-		for {
-			fmt.Print("Enter room code (8 digits): ")
-			var err error
-			roomCode, err = inputReader.ReadString('\n')
-			errCheck(err)
-			roomCode = strings.TrimSpace(roomCode)
-
-			if len(roomCode) == 8 {
-				break
-			}
-
-			fmt.Println("Warning: Room code must be exactly 8 digits! Try again.")
+		// Generate encryption key for this room
+		sess.key, err = GenerateEncryptionKey()
+		if err != nil {
+			fmt.Fprintln(term, "Error generating encryption key:", err)
+			return
 		}
 
-		conn.Write([]byte(roomCode + "\n"))
+		fmt.Fprintln(term, "╔══════════════════════════════════════════════════════╗")
+		fmt.Fprintln(term, "║              ROOM CREATED! (ENCRYPTED)               ║")
+		fmt.Fprintln(term, "╠══════════════════════════════════════════════════════╣")
+		fmt.Fprintf(term, "║   Room Code: %-40s║\n", roomCode)
+		fmt.Fprintln(term, "╠══════════════════════════════════════════════════════╣")
+		fmt.Fprintln(term, "║   ENCRYPTION KEY (share SECURELY with friends!):     ║")
+		fmt.Fprintf(term, "║   %s   ║\n", sess.key)
+		fmt.Fprintln(term, "╠══════════════════════════════════════════════════════╣")
+		fmt.Fprintln(term, "║   WARNING: Anyone with this key can read messages!   ║")
+		fmt.Fprintln(term, "║   Share via secure channel (in person, Signal, etc)  ║")
+		fmt.Fprintln(term, "╠══════════════════════════════════════════════════════╣")
+		fmt.Fprintln(term, "║   OWNER TOKEN (keep it, do NOT share):               ║")
+		fmt.Fprintf(term, "║   %-51s║\n", ack.OwnerToken)
+		fmt.Fprintln(term, "║   Rejoin with -owner-token=... to stay the owner     ║")
+		if ack.MemberToken != "" {
+			fmt.Fprintln(term, "╠══════════════════════════════════════════════════════╣")
+			fmt.Fprintln(term, "║   MEMBER TOKEN (keep it, do NOT share):              ║")
+			fmt.Fprintf(term, "║   %-51s║\n", ack.MemberToken)
+			fmt.Fprintln(term, "║   Rejoin with -member-token=... to get the messages  ║")
+			fmt.Fprintln(term, "║   sent while you were away                           ║")
+		}
+		fmt.Fprintln(term, "╚══════════════════════════════════════════════════════╝")
 
-		response, err := serverReader.ReadString('\n')
-		errCheck(err)
-		response = strings.TrimSpace(response)
+	} else if command == "connect" {
+		join := protocol.Join{OwnerToken: *flagOwnerToken, MemberToken: *flagMemberToken}
 
-		if strings.HasPrefix(response, "ERROR:") {
-			errorMsg := strings.TrimPrefix(response, "ERROR:")
-			fmt.Println("Error:", errorMsg)
+		// Ввод кода комнаты и пароля (с повтором при ошибке, join.go)
+		ack, err := sess.enterRoom(conn, serverReader, hello, &join, &username, true)
+		if err != nil {
+			fmt.Fprintln(term, "Error:", err)
 			return
 		}
+		sess.entered(ack, join, username)
 
 		// Ask for encryption key
-		fmt.Println("")
-		fmt.Println("Room found! Now enter the encryption key.")
-		fmt.Println("(Get this from the person who created the room)")
-		fmt.Println("")
-
-		for {
-			fmt.Print("Enter encryption key: ")
-			var err error
-			encryptionKey, err = inputReader.ReadString('\n')
-			errCheck(err)
-			encryptionKey = strings.TrimSpace(encryptionKey)
-
-			if IsValidKey(encryptionKey) {
-				break
-			}
-
-			fmt.Println("Warning: Invalid key format! Must be 44 characters (Base64). Try again.")
-		}
-
-		fmt.Println("╔══════════════════════════════════════════════════════╗")
-		fmt.Println("║         CONNECTED TO ROOM! (ENCRYPTED)               ║")
-		fmt.Println("╠══════════════════════════════════════════════════════╣")
-		fmt.Println("║   All messages are end-to-end encrypted              ║")
-		fmt.Println("║   Server cannot read your messages                   ║")
-		fmt.Println("╚══════════════════════════════════════════════════════╝")
+		fmt.Fprintln(term, "")
+		fmt.Fprintln(term, "Room found! Now enter the encryption key.")
+		fmt.Fprintln(term, "(Get this from the person who created the room)")
+		fmt.Fprintln(term, "")
+
+		sess.key = askEncryptionKey(inputReader)
+
+		fmt.Fprintln(term, "╔══════════════════════════════════════════════════════╗")
+		fmt.Fprintln(term, "║         CONNECTED TO ROOM! (ENCRYPTED)               ║")
+		fmt.Fprintln(term, "╠══════════════════════════════════════════════════════╣")
+		fmt.Fprintln(term, "║   All messages are end-to-end encrypted              ║")
+		fmt.Fprintln(term, "║   Server cannot read your messages                   ║")
+		fmt.Fprintln(term, "╚══════════════════════════════════════════════════════╝")
 	}
 
-	fmt.Println("")
-	fmt.Println("Type messages and press Enter.")
-	fmt.Println("To exit: Ctrl+C")
-	fmt.Println("")
+	fmt.Fprintln(term, "")
+	fmt.Fprintln(term, "Type messages and press Enter.")
+	fmt.Fprintln(term, "Commands start with \"/\": /help lists them, /quit exits.")
+	fmt.Fprintln(term, "")
+
+	printArrival()
 
 	// ==========================================
 	// ШАГ 10: Горутина для получения сообщений
 	// ==========================================
 
-	go func() {
-		for {
-			message, err := serverReader.ReadString('\n')
-			errCheck(err)
-
-			// Try to decrypt the message
-			// Format from server: "[username] encrypted_data\n"
-			// or system message: ">>> username joined the room\n"
+	// Character-at-a-time input with a status line, if stdin is a
+	// terminal (terminal.go), and typing indicators (typing.go)
+	term.complete = completeCommand
+	term.Start()
+	typing.start(sess)
 
-			message = strings.TrimSpace(message)
-
-			// Check if it's a system message (not encrypted)
-			if strings.HasPrefix(message, ">>>") || strings.HasPrefix(message, "<<<") {
-				fmt.Println(message)
-				continue
-			}
+	if sess.Can(protocol.CapHeartbeat) {
+		startHeartbeat(conn)
+	}
 
-			// Try to parse as encrypted message: "[username] base64_data"
-			if idx := strings.Index(message, "] "); idx != -1 {
-				prefix := message[:idx+2]    // "[username] "
-				encrypted := message[idx+2:] // encrypted part
-
-				decrypted, err := Decrypt(encrypted, encryptionKey)
-				if err != nil {
-					// If decryption fails, show as is (maybe wrong key)
-					fmt.Printf("%s[ENCRYPTED/WRONG KEY]\n", prefix)
-				} else {
-					fmt.Printf("%s%s\n", prefix, decrypted)
-				}
-			} else {
-				// Unknown format, print as is
-				fmt.Println(message)
-			}
-		}
-	}()
+	// Reads frames and reconnects if the connection drops
+	go sess.receive()
 
 	// ==========================================
 	// ШАГ 11: Основной цикл — отправка сообщений
 	// ==========================================
 
 	for {
-		message, err := inputReader.ReadString('\n')
+		message, err := term.ReadLine(inputReader)
 		errCheck(err)
 
 		// Trim the message for encryption (remove newline)
@@ -345,16 +413,215 @@ func main() {
 		if message == "" {
 			continue
 		}
+		typing.lineSent(!isCommand(message))
+
+		// "/who", "/msg bob hi", ... (commands.go); "//text" is a message
+		if isCommand(message) {
+			runCommand(sess, message)
+			continue
+		}
+		message = unescapeMessage(message)
+
+		if !sess.InRoom() {
+			fmt.Fprintln(term, "*** You are not in a room: /join <code> to enter one, /quit to exit")
+			continue
+		}
+
+		// The server drops (and may disconnect for) oversized messages,
+		// so don't even send them
+		if limit := MaxPlaintextSize(sess.MaxMessage()); len(message) > limit {
+			fmt.Fprintf(term, "*** Message is too long (%d bytes, limit %d), not sent\n", len(message), limit)
+			continue
+		}
 
 		// Encrypt the message before sending
-		encrypted, err := Encrypt(message, encryptionKey)
+		encrypted, err := Encrypt(message, sess.Key())
 		if err != nil {
-			fmt.Println("Error encrypting message:", err)
+			fmt.Fprintln(term, "Error encrypting message:", err)
 			continue
 		}
 
-		// Send encrypted message (add newline back for protocol)
-		_, err = conn.Write([]byte(encrypted + "\n"))
-		errCheck(err)
+		// Send encrypted message as a chat frame
+		err = sess.Send(protocol.TypeChat, protocol.Chat{Body: encrypted})
+		if err != nil {
+			fmt.Fprintln(term, "*** Not connected, message not sent")
+		}
+	}
+}
+
+// askLine asks a question and returns the trimmed answer
+func askLine(inputReader *bufio.Reader, question string) string {
+	answer, err := term.Ask(inputReader, question)
+	errCheck(err)
+
+	return strings.TrimSpace(answer)
+}
+
+// askUsername asks until the name follows the server's rules
+func askUsername(inputReader *bufio.Reader) string {
+	for {
+		username := askLine(inputReader, "Enter your username: ")
+		if err := protocol.CheckUsername(username); err != nil {
+			fmt.Fprintf(term, "Warning: %v! Try again.\n", err)
+			continue
+		}
+
+		fmt.Fprintln(term, "Accepted")
+		return username
+	}
+}
+
+// askLimited is askLine that asks again while the answer is longer
+// than max bytes
+func askLimited(inputReader *bufio.Reader, question, what string, max int) string {
+	for {
+		answer := askLine(inputReader, question)
+		if len(answer) <= max {
+			return answer
+		}
+		fmt.Fprintf(term, "Warning: %s is too long (limit %d characters)! Try again.\n", what, max)
+	}
+}
+
+// waitForAck reads frames until the server accepts or refuses our
+// create/join request
+//
+// System notices that arrive meanwhile (e.g. "waiting for the room
+// owner") are printed. A refusal is returned as *protocol.Error.
+func (s *session) waitForAck(reader *bufio.Reader) (protocol.Ack, error) {
+	for {
+		frame, err := protocol.ReadFrame(reader)
+		if err != nil {
+			return protocol.Ack{}, err
+		}
+
+		switch frame.Type {
+		case protocol.TypeAck:
+			var ack protocol.Ack
+			err := frame.Decode(&ack)
+			return ack, err
+
+		case protocol.TypeError:
+			var e protocol.Error
+			if err := frame.Decode(&e); err != nil {
+				return protocol.Ack{}, err
+			}
+			return protocol.Ack{}, &e
+
+		default:
+			s.printFrame(frame)
+		}
+	}
+}
+
+// askYesNo asks a question and returns true only for "y"/"yes"
+func askYesNo(inputReader *bufio.Reader, question string) bool {
+	answer := strings.ToLower(askLine(inputReader, question))
+	return answer == "y" || answer == "yes"
+}
+
+// printFrame shows one frame received from the server
+func (s *session) printFrame(frame protocol.Frame) {
+	switch frame.Type {
+	case protocol.TypeChat:
+		var chat protocol.Chat
+		if err := frame.Decode(&chat); err != nil {
+			return
+		}
+		s.seen(chat.Seq)
+
+		decrypted, err := Decrypt(chat.Body, s.Key())
+		if err != nil {
+			// If decryption fails, don't show the ciphertext (maybe wrong key)
+			decrypted = "[ENCRYPTED/WRONG KEY]"
+		}
+
+		if !chat.History {
+			typing.stopped(chat.From)
+			fmt.Fprintf(term, "[%s] %s\n", chat.From, decrypted)
+			return
+		}
+
+		// Backlog message: show when it was sent
+		sent := time.Unix(chat.Time, 0).Format("15:04")
+		fmt.Fprintf(term, "(history %s) [%s] %s\n", sent, chat.From, decrypted)
+
+		historyPending--
+		if historyPending == 0 {
+			fmt.Fprintln(term, "--- end of history ---")
+		}
+
+	case protocol.TypeSystem:
+		var sys protocol.System
+		if err := frame.Decode(&sys); err != nil {
+			return
+		}
+
+		switch sys.Event {
+		case protocol.EventJoined:
+			direct.forget(sys.Username)
+			fmt.Fprintln(term, ">>>", sys.Text)
+		case protocol.EventLeft:
+			typing.stopped(sys.Username)
+			direct.forget(sys.Username)
+			fmt.Fprintln(term, "<<<", sys.Text)
+		case protocol.EventRenamed:
+			typing.stopped(sys.Previous)
+			direct.forget(sys.Previous)
+			fmt.Fprintln(term, "***", sys.Text)
+		case protocol.EventShutdown:
+			fmt.Fprintln(term, "***", sys.Text)
+			if sys.RetryAfter > 0 {
+				// reconnect.go waits this long before the first attempt
+				s.mu.Lock()
+				s.retryAfter = time.Duration(sys.RetryAfter) * time.Second
+				s.mu.Unlock()
+			}
+		case protocol.EventKicked, protocol.EventClosed:
+			fmt.Fprintln(term, "***", sys.Text)
+			s.mu.Lock()
+			s.stayAway = true
+			s.mu.Unlock()
+		default:
+			fmt.Fprintln(term, "***", sys.Text)
+		}
+
+	case protocol.TypeTyping:
+		var ev protocol.Typing
+		if err := frame.Decode(&ev); err != nil {
+			return
+		}
+		typing.received(ev)
+
+	case protocol.TypeWho:
+		var who protocol.Who
+		if err := frame.Decode(&who); err != nil {
+			return
+		}
+		if !direct.membersReceived(who) {
+			printMembers(who)
+		}
+
+	case protocol.TypeDirect:
+		var msg protocol.Direct
+		if err := frame.Decode(&msg); err != nil {
+			return
+		}
+		direct.received(msg)
+
+	case protocol.TypeKnock:
+		var knock protocol.Knock
+		if err := frame.Decode(&knock); err != nil {
+			return
+		}
+		fmt.Fprintf(term, "*** %s wants to join. Type /accept %s or /reject %s\n",
+			knock.Username, knock.Username, knock.Username)
+
+	case protocol.TypeError:
+		var e protocol.Error
+		if err := frame.Decode(&e); err != nil {
+			return
+		}
+		fmt.Fprintln(term, "Error:", e.Message)
 	}
 }
@@ -0,0 +1,257 @@
+package main
+
+// ============================================================
+// SLASH COMMANDS
+// ============================================================
+//
+// A line that starts with "/" is a command, not a message: "/who",
+// "/msg bob hi". A line that starts with "//" is sent as a message
+// without the first slash, so "//shrug" arrives as "/shrug".
+//
+// Every command registers itself with registerCommand, usually from
+// the init function of the file that implements it (who.go, direct.go,
+// ...). The same table drives /help and Tab completion, so a new
+// command only has to be registered to show up in both.
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"messenger-protocol"
+)
+
+// command is one slash command
+type command struct {
+	name string // without the slash: "msg"
+	args string // argument synopsis for /help: "<username> <text>"
+	help string // one line for /help
+
+	// run gets everything after the command name, trimmed
+	run func(sess *session, args string)
+}
+
+// commands by name (registerCommand)
+var commands = make(map[string]*command)
+
+// registerCommand makes c available as "/" + c.name
+func registerCommand(c *command) {
+	if _, dup := commands[c.name]; dup {
+		panic("command registered twice: /" + c.name)
+	}
+	commands[c.name] = c
+}
+
+// isCommand reports whether an input line is a command
+func isCommand(line string) bool {
+	return strings.HasPrefix(line, "/") && !strings.HasPrefix(line, "//")
+}
+
+// unescapeMessage turns "//text" into "/text"; other lines are unchanged
+func unescapeMessage(line string) string {
+	if strings.HasPrefix(line, "//") {
+		return line[1:]
+	}
+	return line
+}
+
+// runCommand executes a command line ("/name args")
+func runCommand(sess *session, line string) {
+	name, args, _ := strings.Cut(strings.TrimPrefix(line, "/"), " ")
+
+	c, ok := commands[strings.ToLower(name)]
+	if !ok {
+		fmt.Fprintf(term, "*** Unknown command /%s%s. Type /help for the list\n", name, suggest(name))
+		return
+	}
+	c.run(sess, strings.TrimSpace(args))
+}
+
+// commandNames returns the registered names that start with prefix, sorted
+func commandNames(prefix string) []string {
+	var names []string
+	for name := range commands {
+		if strings.HasPrefix(name, prefix) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// suggest returns " (did you mean /who?)" when name is the start of
+// exactly one command, or ""
+func suggest(name string) string {
+	if names := commandNames(strings.ToLower(name)); name != "" && len(names) == 1 {
+		return " (did you mean /" + names[0] + "?)"
+	}
+	return ""
+}
+
+// usage is "/name args", as shown by /help
+func (c *command) usage() string {
+	if c.args == "" {
+		return "/" + c.name
+	}
+	return "/" + c.name + " " + c.args
+}
+
+// completeCommand completes a command name on Tab
+//
+// One match is completed in full; several are completed as far as they
+// agree, and listed when that adds nothing. Lines that are not a command
+// name being typed are returned as they are.
+func completeCommand(line string) string {
+	if !isCommand(line) || strings.Contains(line, " ") {
+		return line
+	}
+
+	prefix := strings.ToLower(line[1:])
+	names := commandNames(prefix)
+	switch len(names) {
+	case 0:
+		return line
+	case 1:
+		return "/" + names[0] + " "
+	}
+
+	common := names[0]
+	for _, name := range names[1:] {
+		for !strings.HasPrefix(name, common) {
+			common = common[:len(common)-1]
+		}
+	}
+	if common != prefix {
+		return "/" + common
+	}
+
+	for _, name := range names {
+		fmt.Fprintf(term, "  %-28s %s\n", commands[name].usage(), commands[name].help)
+	}
+	return line
+}
+
+// printHelp lists the commands, or explains one ("/help msg")
+func printHelp(sess *session, args string) {
+	if args != "" {
+		c, ok := commands[strings.ToLower(strings.TrimPrefix(args, "/"))]
+		if !ok {
+			fmt.Fprintf(term, "*** Unknown command /%s. Type /help for the list\n", strings.TrimPrefix(args, "/"))
+			return
+		}
+		fmt.Fprintf(term, "  %-28s %s\n", c.usage(), c.help)
+		return
+	}
+
+	fmt.Fprintln(term, "--- Commands (Tab completes them) ---")
+	for _, name := range commandNames("") {
+		fmt.Fprintf(term, "  %-28s %s\n", commands[name].usage(), commands[name].help)
+	}
+	fmt.Fprintf(term, "  %-28s %s\n", "//text", `Send a message that starts with "/"`)
+}
+
+// ============================================================
+// BUILT-IN COMMANDS
+// ============================================================
+
+func init() {
+	registerCommand(&command{
+		name: "help",
+		args: "[command]",
+		help: "List the commands, or explain one",
+		run:  printHelp,
+	})
+
+	registerCommand(&command{
+		name: "quit",
+		help: "Leave the room and exit",
+		run: func(sess *session, args string) {
+			if sess.InRoom() {
+				sess.leave()
+			}
+			fmt.Fprintln(term, "*** Bye!")
+			exit(0)
+		},
+	})
+
+	registerCommand(&command{
+		name: "clear",
+		help: "Clear the screen",
+		run: func(sess *session, args string) {
+			term.Clear()
+		},
+	})
+
+	registerCommand(&command{
+		name: "key",
+		help: "Show the room code and encryption key, to invite someone",
+		run: func(sess *session, args string) {
+			if !sess.InRoom() {
+				fmt.Fprintln(term, "*** You are not in a room")
+				return
+			}
+			fmt.Fprintln(term, "*** Room code:     ", sess.RoomCode())
+			fmt.Fprintln(term, "*** Encryption key:", sess.Key())
+			fmt.Fprintln(term, "*** Anyone with the key can read the room: share it over a secure channel")
+		},
+	})
+
+	registerCommand(&command{
+		name: "nick",
+		args: "<username>",
+		help: "Change your username in the room",
+		run:  changeNick,
+	})
+
+	// Owner's answer to a join request (knock)
+	registerCommand(&command{
+		name: "accept",
+		args: "<username>",
+		help: "Let someone who knocked into the room",
+		run:  func(sess *session, args string) { answerKnock(sess, args, true) },
+	})
+	registerCommand(&command{
+		name: "reject",
+		args: "<username>",
+		help: "Turn away someone who knocked",
+		run:  func(sess *session, args string) { answerKnock(sess, args, false) },
+	})
+}
+
+// answerKnock lets username in (accept) or turns them away
+func answerKnock(sess *session, username string, accept bool) {
+	if username == "" || strings.Contains(username, " ") {
+		fmt.Fprintln(term, "*** Usage: /accept <username> or /reject <username>")
+		return
+	}
+	err := sess.Send(protocol.TypeKnock, protocol.Knock{Username: username, Accept: accept})
+	if err != nil {
+		fmt.Fprintln(term, "*** Not connected, answer not sent")
+	}
+}
+
+// changeNick asks the server for a new username (/nick)
+//
+// The server answers everyone with a "renamed" event; our own name
+// changes when it arrives (see session.noteRename).
+func changeNick(sess *session, args string) {
+	switch {
+	case args == "":
+		fmt.Fprintln(term, "*** Usage: /nick <username>")
+		return
+	case !sess.InRoom():
+		fmt.Fprintln(term, "*** You are not in a room")
+		return
+	case !sess.Can(protocol.CapNick):
+		fmt.Fprintln(term, "*** This server doesn't allow changing your username")
+		return
+	}
+	if err := protocol.CheckUsername(args); err != nil {
+		fmt.Fprintf(term, "*** %v\n", err)
+		return
+	}
+
+	if err := sess.Send(protocol.TypeNick, protocol.Nick{Username: args}); err != nil {
+		fmt.Fprintln(term, "*** Not connected, try again later")
+	}
+}
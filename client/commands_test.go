@@ -0,0 +1,132 @@
+package main
+
+import "testing"
+
+// withCommands replaces the command table for one test
+//
+// Every command records its arguments in ran under its own name.
+func withCommands(t *testing.T, names ...string) map[string]string {
+	old := commands
+	commands = make(map[string]*command)
+	t.Cleanup(func() { commands = old })
+
+	ran := make(map[string]string)
+	for _, name := range names {
+		name := name
+		registerCommand(&command{name: name, run: func(_ *session, args string) { ran[name] = args }})
+	}
+	return ran
+}
+
+func TestIsCommand(t *testing.T) {
+	tests := []struct {
+		line string
+		want bool
+	}{
+		{"/who", true},
+		{"/msg bob hi", true},
+		{"/", true},
+		{"//shrug", false},
+		{"///", false},
+		{"hello /who", false},
+		{" /who", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		if got := isCommand(tt.line); got != tt.want {
+			t.Errorf("isCommand(%q) = %v, want %v", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestUnescapeMessage(t *testing.T) {
+	tests := []struct {
+		line string
+		want string
+	}{
+		{"//shrug", "/shrug"},
+		{"///", "//"},
+		{"//", "/"},
+		{"hello", "hello"},
+		{"a // b", "a // b"},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		if got := unescapeMessage(tt.line); got != tt.want {
+			t.Errorf("unescapeMessage(%q) = %q, want %q", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestCompleteCommand(t *testing.T) {
+	withCommands(t, "who", "msg", "me", "nick", "knock", "knocks")
+
+	tests := []struct {
+		line string
+		want string
+	}{
+		{"/w", "/who "},          // one match: full name and a space
+		{"/WH", "/who "},         // any case
+		{"/who", "/who "},        // already complete
+		{"/n", "/nick "},         // "knock" does not start with "n"
+		{"/m", "/m"},             // "msg" and "me": nothing in common, list printed
+		{"/k", "/knock"},         // "knock" and "knocks": common part only
+		{"/knock", "/knock"},     // still ambiguous: list printed
+		{"/knocks", "/knocks "},  // exact and only match
+		{"/x", "/x"},             // no match
+		{"/", "/"},               // everything matches: nothing in common
+		{"/who bob", "/who bob"}, // arguments are not completed
+		{"//w", "//w"},           // escaped message
+		{"hello", "hello"},       // plain message
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		if got := completeCommand(tt.line); got != tt.want {
+			t.Errorf("completeCommand(%q) = %q, want %q", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestRunCommand(t *testing.T) {
+	ran := withCommands(t, "msg", "who")
+
+	runCommand(nil, "/msg bob  hello there ")
+	if args, ok := ran["msg"]; !ok || args != "bob  hello there" {
+		t.Errorf("/msg ran with %q (%v), want %q", args, ok, "bob  hello there")
+	}
+
+	runCommand(nil, "/WHO")
+	if args, ok := ran["who"]; !ok || args != "" {
+		t.Errorf("/WHO ran with %q (%v), want /who without arguments", args, ok)
+	}
+
+	delete(ran, "who")
+	runCommand(nil, "/wh")
+	if _, ok := ran["who"]; ok {
+		t.Error("a prefix ran the command instead of suggesting it")
+	}
+}
+
+func TestSuggest(t *testing.T) {
+	withCommands(t, "who", "msg", "me")
+
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"wh", " (did you mean /who?)"},
+		{"MS", " (did you mean /msg?)"},
+		{"m", ""}, // two commands
+		{"x", ""},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		if got := suggest(tt.name); got != tt.want {
+			t.Errorf("suggest(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
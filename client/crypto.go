@@ -88,6 +88,9 @@ func DecodeKey(keyBase64 string) ([]byte, error) {
 //
 //	[nonce (12 bytes)][ciphertext][auth tag (16 bytes)]
 //	All encoded as Base64
+//
+// Other clients (e.g. in the browser) must produce exactly this
+// format — see "Message encryption" in PROTOCOL.md.
 func Encrypt(plaintext string, keyBase64 string) (string, error) {
 	// Step 1: Decode the Base64 key to bytes
 	key, err := DecodeKey(keyBase64)
@@ -139,6 +142,20 @@ func Encrypt(plaintext string, keyBase64 string) (string, error) {
 	return base64.StdEncoding.EncodeToString(ciphertext), nil
 }
 
+// MaxPlaintextSize returns the longest message (in bytes) whose
+// encrypted form fits in limit bytes
+//
+// Encrypted = Base64([nonce][ciphertext][tag]); GCM ciphertext is as
+// long as the plaintext, nonce and tag add 12 + 16 bytes.
+func MaxPlaintextSize(limit int) int {
+	const overhead = 12 + 16
+	n := base64.StdEncoding.DecodedLen(limit) - overhead
+	if n < 0 {
+		return 0
+	}
+	return n
+}
+
 // ============================================================
 // DECRYPTION
 // ============================================================
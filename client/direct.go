@@ -0,0 +1,413 @@
+package main
+
+// ============================================================
+// PRIVATE MESSAGES (/msg)
+// ============================================================
+//
+// "/msg bob text" sends text to bob alone. Everyone in the room holds
+// the room key, so it can't protect a private message. Instead each
+// client makes a P-256 key pair at startup and sends the public half
+// in its hello; the server lists members' keys in "who" answers.
+//
+// ECDH of our private key with bob's public key gives a secret that
+// the rest of the room can't compute; SHA-256 of it is the AES-256-GCM
+// key for the message, in the same format as room messages (crypto.go).
+//
+// The public keys come from the server, and nothing in them proves
+// whose they are: a tampering server could hand out its own and read
+// everything. So a key is only used once the user has compared its
+// fingerprint with bob over a channel they trust (/fingerprint on his
+// side, /verify bob <fingerprint> on ours). Until then nothing is
+// sent to bob and nothing from him is shown.
+//
+// Bob's key is looked up with a "who" request the first time and
+// remembered until he leaves or joins again. Keys arriving with his
+// messages are only checked, never remembered.
+
+import (
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"messenger-protocol"
+)
+
+// directKeyLabel separates our derived keys from any other use of
+// the same ECDH secret
+const directKeyLabel = "messenger direct v1"
+
+// keyPair is our key for private messages (lives only in memory)
+type keyPair struct {
+	private []byte
+	public  string // Base64 of the uncompressed point
+}
+
+// myKeys is nil if the key could not be made; then we don't
+// offer the "direct" capability
+var myKeys *keyPair
+
+// newKeyPair makes a fresh P-256 key pair
+func newKeyPair() (*keyPair, error) {
+	curve := elliptic.P256()
+	private, x, y, err := elliptic.GenerateKey(curve, rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	return &keyPair{
+		private: private,
+		public:  base64.StdEncoding.EncodeToString(elliptic.Marshal(curve, x, y)),
+	}, nil
+}
+
+// publicKey is what we send in hello ("" without a key pair)
+func publicKey() string {
+	if myKeys == nil {
+		return ""
+	}
+	return myKeys.public
+}
+
+// sharedKey derives the message key we share with the owner of peerKey
+//
+// Returns it in Base64, ready for Encrypt and Decrypt.
+func (k *keyPair) sharedKey(peerKey string) (string, error) {
+	curve := elliptic.P256()
+
+	raw, err := base64.StdEncoding.DecodeString(peerKey)
+	if err != nil {
+		return "", errors.New("invalid public key format")
+	}
+	// Unmarshal also checks that the point is on the curve
+	x, y := elliptic.Unmarshal(curve, raw)
+	if x == nil {
+		return "", errors.New("invalid public key")
+	}
+
+	sx, _ := curve.ScalarMult(x, y, k.private)
+	secret := make([]byte, 32)
+	sx.FillBytes(secret)
+
+	sum := sha256.Sum256(append([]byte(directKeyLabel), secret...))
+	return base64.StdEncoding.EncodeToString(sum[:]), nil
+}
+
+// keyFingerprint is a short digest of a public key for people to compare
+// over another channel, e.g. "3f2a 9c01 77be 4d10 e5a2" ("" if the key
+// is not valid Base64)
+func keyFingerprint(publicKey string) string {
+	raw, err := base64.StdEncoding.DecodeString(publicKey)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(raw)
+	digits := hex.EncodeToString(sum[:fingerprintBytes])
+
+	return groupDigits(digits)
+}
+
+// fingerprintBytes is how much of the SHA-256 a key fingerprint shows:
+// 80 bits, too many for a server to find a key with the same one
+const fingerprintBytes = 10
+
+// groupDigits splits hex digits into groups of four, for reading aloud
+func groupDigits(digits string) string {
+	var groups []string
+	for i := 0; i < len(digits); i += 4 {
+		groups = append(groups, digits[i:i+4])
+	}
+	return strings.Join(groups, " ")
+}
+
+// normalizeFingerprint turns what the user typed into keyFingerprint's
+// format, or "" if it isn't one
+func normalizeFingerprint(typed string) string {
+	digits := strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', ':', '-':
+			return -1
+		}
+		return r
+	}, strings.ToLower(typed))
+
+	if len(digits) != 2*fingerprintBytes {
+		return ""
+	}
+	if _, err := hex.DecodeString(digits); err != nil {
+		return ""
+	}
+
+	return groupDigits(digits)
+}
+
+// ============================================================
+// KEYS OF OTHER MEMBERS
+// ============================================================
+
+var (
+	errKeyUnverified = errors.New("key not verified")
+	errKeyChanged    = errors.New("key changed since it was verified")
+)
+
+// pendingDirect is a message waiting for its recipient's key
+type pendingDirect struct {
+	to   string
+	text string
+}
+
+// directState remembers members' keys and unsent messages
+type directState struct {
+	mu       sync.Mutex
+	sess     *session
+	keys     map[string]string // lower-case username → public key
+	verified map[string]string // lower-case username → fingerprint confirmed with /verify
+	pending  []pendingDirect
+	lookups  int // our own "who" requests whose answers aren't printed
+}
+
+var direct = &directState{keys: make(map[string]string), verified: make(map[string]string)}
+
+// send encrypts text for to and sends it, looking up the key first
+// if we don't have it yet
+func (d *directState) send(sess *session, to, text string) {
+	switch {
+	case myKeys == nil || !sess.Can(protocol.CapDirect) || !sess.Can(protocol.CapWho):
+		fmt.Fprintln(term, "*** This server can't deliver private messages")
+		return
+	case !sess.InRoom():
+		fmt.Fprintln(term, "*** You are not in a room")
+		return
+	case strings.EqualFold(to, sess.Username()):
+		fmt.Fprintln(term, "*** That's you")
+		return
+	}
+	if limit := MaxPlaintextSize(sess.MaxMessage()); len(text) > limit {
+		fmt.Fprintf(term, "*** Message is too long (%d bytes, limit %d), not sent\n", len(text), limit)
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.sess = sess
+	if key, ok := d.keys[strings.ToLower(to)]; ok {
+		d.deliver(to, text, key)
+		return
+	}
+
+	// Ask the server about them; the message goes out with the answer
+	d.pending = append(d.pending, pendingDirect{to: to, text: text})
+	if err := sess.Send(protocol.TypeWho, protocol.Who{Username: to}); err != nil {
+		fmt.Fprintln(term, "*** Not connected, message not sent")
+		d.pending = d.pending[:len(d.pending)-1]
+		return
+	}
+	d.lookups++
+}
+
+// checkKey tells whether key is the one the user verified for username
+// (under mu)
+func (d *directState) checkKey(username, key string) error {
+	want, ok := d.verified[strings.ToLower(username)]
+	switch {
+	case !ok:
+		return errKeyUnverified
+	case keyFingerprint(key) != want:
+		return errKeyChanged
+	}
+	return nil
+}
+
+// explainKey tells the user what to do about checkKey's err
+func explainKey(username, key string, err error) {
+	if errors.Is(err, errKeyChanged) {
+		fmt.Fprintf(term, "*** %s's key has changed since you verified it (now %s).\n", username, keyFingerprint(key))
+		fmt.Fprintf(term, "*** They may have restarted the client, or someone is in between: compare again\n")
+	} else {
+		fmt.Fprintf(term, "*** You haven't verified %s's key yet. The server says its fingerprint is %s.\n", username, keyFingerprint(key))
+		fmt.Fprintf(term, "*** Ask %s for theirs (/fingerprint) over a channel you trust\n", username)
+	}
+	fmt.Fprintf(term, "*** and if it's the same: /verify %s <fingerprint>\n", username)
+}
+
+// deliver encrypts and sends one message (under mu)
+func (d *directState) deliver(to, text, key string) {
+	if err := d.checkKey(to, key); err != nil {
+		fmt.Fprintf(term, "*** Private message to %s not sent\n", to)
+		explainKey(to, key, err)
+		return
+	}
+
+	shared, err := myKeys.sharedKey(key)
+	if err != nil {
+		fmt.Fprintf(term, "*** Can't encrypt for %s: %v\n", to, err)
+		return
+	}
+	encrypted, err := Encrypt(text, shared)
+	if err != nil {
+		fmt.Fprintln(term, "Error encrypting message:", err)
+		return
+	}
+	if err := d.sess.Send(protocol.TypeDirect, protocol.Direct{To: to, Body: encrypted}); err != nil {
+		fmt.Fprintln(term, "*** Not connected, message not sent")
+	}
+}
+
+// membersReceived learns the keys from a "who" answer and sends the
+// messages that were waiting for them
+//
+// Returns true if the answer was our own lookup and shouldn't be printed.
+func (d *directState) membersReceived(who protocol.Who) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for _, m := range who.Members {
+		if m.PublicKey != "" {
+			d.keys[strings.ToLower(m.Username)] = m.PublicKey
+		}
+	}
+
+	lookup := d.lookups > 0
+	if lookup {
+		d.lookups--
+	}
+
+	var waiting []pendingDirect
+	for _, p := range d.pending {
+		key, ok := d.keys[strings.ToLower(p.to)]
+		switch {
+		case ok:
+			d.deliver(p.to, p.text, key)
+		case lookup:
+			fmt.Fprintf(term, "*** %s is not in the room or can't receive private messages\n", p.to)
+		default:
+			waiting = append(waiting, p)
+		}
+	}
+	d.pending = waiting
+
+	return lookup
+}
+
+// forget drops username's key: they left, or joined with a new one
+func (d *directState) forget(username string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	delete(d.keys, strings.ToLower(username))
+}
+
+// reset forgets everything about the room we left
+func (d *directState) reset() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.keys = make(map[string]string)
+	d.verified = make(map[string]string)
+	d.pending = nil
+	d.lookups = 0
+}
+
+// received prints a private message sent to us
+//
+// The sender's key in the frame comes from the server, so the message
+// is only shown if it is the key the user verified.
+func (d *directState) received(msg protocol.Direct) {
+	sent := time.Unix(msg.Time, 0).Format("15:04")
+
+	d.mu.Lock()
+	err := d.checkKey(msg.From, msg.Key)
+	d.mu.Unlock()
+	if err != nil {
+		fmt.Fprintf(term, "(private %s) [%s → you] [NOT SHOWN: UNVERIFIED KEY]\n", sent, msg.From)
+		explainKey(msg.From, msg.Key, err)
+		return
+	}
+
+	text := "[ENCRYPTED/WRONG KEY]"
+	if myKeys != nil {
+		if shared, err := myKeys.sharedKey(msg.Key); err == nil {
+			if decrypted, err := Decrypt(msg.Body, shared); err == nil {
+				text = decrypted
+			}
+		}
+	}
+	fmt.Fprintf(term, "(private %s) [%s → you] %s\n", sent, msg.From, text)
+}
+
+// verify remembers the fingerprint username gave us (/verify)
+func (d *directState) verify(username, typed string) {
+	fp := normalizeFingerprint(typed)
+	if fp == "" {
+		fmt.Fprintf(term, "*** A fingerprint is %d hex digits, e.g. %s\n", 2*fingerprintBytes, keyFingerprint(publicKey()))
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.verified[strings.ToLower(username)] = fp
+
+	key, ok := d.keys[strings.ToLower(username)]
+	switch {
+	case !ok:
+		fmt.Fprintf(term, "*** Saved: private messages to and from %s will be checked against it\n", username)
+	case keyFingerprint(key) == fp:
+		fmt.Fprintf(term, "*** %s's key verified\n", username)
+	default:
+		fmt.Fprintf(term, "*** Warning: the server gave a different key for %s (%s).\n", username, keyFingerprint(key))
+		fmt.Fprintln(term, "*** Check the fingerprint again: if it is right, someone is in between")
+	}
+}
+
+func init() {
+	registerCommand(&command{
+		name: "msg",
+		args: "<username> <text>",
+		help: "Send a private message that only that member can read",
+		run: func(sess *session, args string) {
+			to, text, _ := strings.Cut(args, " ")
+			text = strings.TrimSpace(text)
+			if to == "" || text == "" {
+				fmt.Fprintln(term, "*** Usage: /msg <username> <text>")
+				return
+			}
+			direct.send(sess, to, text)
+		},
+	})
+
+	registerCommand(&command{
+		name: "fingerprint",
+		help: "Show your key's fingerprint, for others to /verify",
+		run: func(sess *session, args string) {
+			if myKeys == nil {
+				fmt.Fprintln(term, "*** No key for private messages")
+				return
+			}
+			fmt.Fprintln(term, "*** Your key fingerprint:", keyFingerprint(myKeys.public))
+			fmt.Fprintln(term, "*** Read it to the people you message over a channel you trust (not this room);")
+			fmt.Fprintln(term, "*** they confirm it with /verify <your name> <fingerprint>. It changes when you restart.")
+		},
+	})
+
+	registerCommand(&command{
+		name: "verify",
+		args: "<username> <fingerprint>",
+		help: "Confirm a member's key before private messages",
+		run: func(sess *session, args string) {
+			username, fp, _ := strings.Cut(args, " ")
+			if username == "" || strings.TrimSpace(fp) == "" {
+				fmt.Fprintln(term, "*** Usage: /verify <username> <fingerprint>")
+				return
+			}
+			direct.verify(username, fp)
+		},
+	})
+}
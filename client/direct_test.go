@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"testing"
+
+	"messenger-protocol"
+)
+
+func newTestKeys(t *testing.T) *keyPair {
+	t.Helper()
+	k, err := newKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k
+}
+
+func TestSharedKeySymmetric(t *testing.T) {
+	alice, bob := newTestKeys(t), newTestKeys(t)
+
+	ab, err := alice.sharedKey(bob.public)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ba, err := bob.sharedKey(alice.public)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ab != ba {
+		t.Errorf("alice derives %s, bob derives %s", ab, ba)
+	}
+	if !IsValidKey(ab) {
+		t.Errorf("shared key %q is not a valid message key", ab)
+	}
+
+	// A third member gets a different key with either of them
+	carol := newTestKeys(t)
+	if ac, _ := alice.sharedKey(carol.public); ac == ab {
+		t.Error("alice shares the same key with bob and carol")
+	}
+}
+
+func TestSharedKeyBadPeer(t *testing.T) {
+	k := newTestKeys(t)
+
+	tests := []string{
+		"",
+		"not base64!",
+		"AAAA",
+		base64.StdEncoding.EncodeToString(make([]byte, 65)), // not on the curve
+	}
+	for _, peer := range tests {
+		if _, err := k.sharedKey(peer); err == nil {
+			t.Errorf("sharedKey(%q) succeeded", peer)
+		}
+	}
+}
+
+func TestDirectRoundTrip(t *testing.T) {
+	alice, bob := newTestKeys(t), newTestKeys(t)
+
+	key, err := alice.sharedKey(bob.public)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := Encrypt("meet at 6", key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Bob decrypts with the key he derives from alice's public half
+	key, err = bob.sharedKey(alice.public)
+	if err != nil {
+		t.Fatal(err)
+	}
+	text, err := Decrypt(body, key)
+	if err != nil || text != "meet at 6" {
+		t.Errorf("Decrypt() = %q, %v", text, err)
+	}
+
+	// The room (or anyone else) can't
+	carol := newTestKeys(t)
+	key, _ = carol.sharedKey(alice.public)
+	if _, err := Decrypt(body, key); err == nil {
+		t.Error("carol decrypted a message between alice and bob")
+	}
+}
+
+func TestNormalizeFingerprint(t *testing.T) {
+	tests := []struct {
+		typed string
+		want  string
+	}{
+		{"3f2a 9c01 77be 4d10 e5a2", "3f2a 9c01 77be 4d10 e5a2"},
+		{"3F2A9C0177BE4D10E5A2", "3f2a 9c01 77be 4d10 e5a2"},
+		{"3f:2a:9c:01:77:be:4d:10:e5:a2", "3f2a 9c01 77be 4d10 e5a2"},
+		{" 3f2a-9c01-77be-4d10-e5a2 ", "3f2a 9c01 77be 4d10 e5a2"},
+		{"3f2a 9c01 77be 4d10", ""},
+		{"3f2a 9c01 77be 4d10 e5a2 00", ""},
+		{"3f2a 9c01 77be 4d10 e5az", ""},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		if got := normalizeFingerprint(tt.typed); got != tt.want {
+			t.Errorf("normalizeFingerprint(%q) = %q, want %q", tt.typed, got, tt.want)
+		}
+	}
+
+	k := newTestKeys(t)
+	if fp := keyFingerprint(k.public); normalizeFingerprint(fp) != fp {
+		t.Errorf("keyFingerprint() = %q is not in its own format", fp)
+	}
+}
+
+func TestCheckKey(t *testing.T) {
+	bob, server := newTestKeys(t), newTestKeys(t)
+
+	d := &directState{keys: make(map[string]string), verified: make(map[string]string)}
+	if err := d.checkKey("bob", bob.public); !errors.Is(err, errKeyUnverified) {
+		t.Errorf("before /verify: got %v, want errKeyUnverified", err)
+	}
+
+	d.verified["bob"] = keyFingerprint(bob.public)
+	if err := d.checkKey("Bob", bob.public); err != nil {
+		t.Errorf("verified key: %v", err)
+	}
+	if err := d.checkKey("bob", server.public); !errors.Is(err, errKeyChanged) {
+		t.Errorf("swapped key: got %v, want errKeyChanged", err)
+	}
+}
+
+func TestReceivedDoesNotLearnKeys(t *testing.T) {
+	saved := myKeys
+	defer func() { myKeys = saved }()
+	myKeys = newTestKeys(t)
+
+	// The server swaps in its own key in a direct frame
+	server := newTestKeys(t)
+	key, err := server.sharedKey(myKeys.public)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := Encrypt("hi, it's bob", key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := &directState{keys: make(map[string]string), verified: make(map[string]string)}
+	d.received(protocol.Direct{From: "bob", Body: body, Key: server.public})
+
+	if got, ok := d.keys["bob"]; ok {
+		t.Errorf("received() remembered %q as bob's key", got)
+	}
+}
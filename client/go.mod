@@ -2,3 +2,6 @@ module messenger-client
 
 go 1.18
 
+require messenger-protocol v0.0.0
+
+replace messenger-protocol => ../protocol
@@ -0,0 +1,77 @@
+package main
+
+// ============================================================
+// HEARTBEAT
+// ============================================================
+//
+// When both sides support "heartbeat", the client pings the server every
+// -ping-interval and answers the server's pings. If nothing at all
+// arrives from the server for -idle-timeout, the connection is treated
+// as lost — a vanished network would otherwise look like a quiet room.
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"time"
+
+	"messenger-protocol"
+)
+
+var (
+	pingInterval = 30 * time.Second
+	idleTimeout  = 90 * time.Second
+)
+
+// startHeartbeat pings the server until the connection breaks
+func startHeartbeat(conn net.Conn) {
+	go func() {
+		ticker := time.NewTicker(pingInterval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			err := protocol.Send(conn, protocol.TypePing, protocol.Ping{Time: time.Now().UnixMilli()})
+			if err != nil {
+				return
+			}
+		}
+	}()
+}
+
+// answerPing echoes a server ping back as a pong
+func answerPing(conn net.Conn, frame protocol.Frame) {
+	var ping protocol.Ping
+	if err := frame.Decode(&ping); err != nil {
+		return
+	}
+	protocol.Send(conn, protocol.TypePong, ping)
+}
+
+// extendDeadline gives the server another idleTimeout to say something
+// (only with heartbeat: a quiet server is otherwise just a quiet room)
+func extendDeadline(conn net.Conn) {
+	conn.SetReadDeadline(time.Now().Add(idleTimeout))
+}
+
+// connectionLost explains why the connection ended and exits
+func connectionLost(err error) {
+	fmt.Fprintln(term, "")
+	fmt.Fprintln(term, "*** Connection lost:", describeLoss(err))
+	exit(1)
+}
+
+// describeLoss turns a read/write error into a human explanation
+func describeLoss(err error) string {
+	switch {
+	case errors.Is(err, os.ErrDeadlineExceeded):
+		return fmt.Sprintf("no response from the server for %s", idleTimeout)
+	case errors.Is(err, io.EOF):
+		return "the server closed the connection"
+	case err != nil:
+		return err.Error()
+	default:
+		return "unknown error"
+	}
+}
@@ -0,0 +1,291 @@
+package main
+
+// ============================================================
+// ENTERING AND LEAVING ROOMS (/join, /leave)
+// ============================================================
+//
+// /leave closes the connection: the room sees us leave and the client
+// stays open without a room. /join <code> connects again and enters a
+// room, asking for the password and the encryption key just like at
+// startup; in a room, it leaves that room first.
+//
+// While we are out of a room the receiving goroutine (reconnect.go)
+// waits in waitForRoom instead of reconnecting. /join doesn't touch the
+// session until it is parked there, so the two never work on the same
+// room at once.
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"messenger-protocol"
+)
+
+func init() {
+	registerCommand(&command{
+		name: "leave",
+		help: "Leave the room (stay in the client)",
+		run: func(sess *session, args string) {
+			if !sess.InRoom() {
+				fmt.Fprintln(term, "*** You are not in a room")
+				return
+			}
+			sess.leave()
+			fmt.Fprintln(term, "*** You left the room. /join <code> to enter a room, /quit to exit")
+		},
+	})
+
+	registerCommand(&command{
+		name: "join",
+		args: "<room code>",
+		help: "Enter another room (leaving this one)",
+		run: func(sess *session, args string) {
+			if args == "" {
+				fmt.Fprintln(term, "*** Usage: /join <room code>")
+				return
+			}
+			sess.switchRoom(args)
+		},
+	})
+}
+
+// enterRoom sends join requests until the server lets us in
+//
+// Whatever the server objects to is asked again: the password, the
+// username and, with askCode, the room code. Without askCode an
+// unknown room is returned as an error. join and username are updated
+// with what was finally accepted. hello is the server's on conn.
+func (s *session) enterRoom(conn net.Conn, reader *bufio.Reader, hello protocol.Hello, join *protocol.Join, username *string, askCode bool) (protocol.Ack, error) {
+	input := s.input
+	for {
+		for join.Code == "" {
+			join.Code = askLimited(input, "Enter room code ("+codeFormat(hello)+"): ", "Room code", protocol.MaxCodeLength)
+			if join.Code == "" {
+				fmt.Fprintln(term, "Warning: Room code cannot be empty! Try again.")
+			}
+		}
+
+		if err := protocol.Send(conn, protocol.TypeJoin, *join); err != nil {
+			return protocol.Ack{}, err
+		}
+
+		ack, err := s.waitForAck(reader)
+		if err == nil {
+			return ack, nil
+		}
+
+		var protoErr *protocol.Error
+		if !errors.As(err, &protoErr) {
+			return protocol.Ack{}, err
+		}
+
+		switch protoErr.Code {
+		case protocol.ErrRoomNotFound:
+			if !askCode {
+				return protocol.Ack{}, err
+			}
+			fmt.Fprintln(term, "Warning: Room not found! Check the code ("+codeFormat(hello)+") and try again.")
+			join.Code = ""
+			join.Secret = ""
+		case protocol.ErrTooManyAttempts:
+			fmt.Fprintln(term, "Warning:", protoErr.Message)
+			time.Sleep(time.Duration(protoErr.RetryAfter) * time.Second)
+		case protocol.ErrUsernameTaken, protocol.ErrBadUsername:
+			fmt.Fprintln(term, "Warning:", protoErr.Message)
+			*username = askUsername(input)
+			join.Username = *username
+		case protocol.ErrBadSecret:
+			if join.Secret != "" {
+				fmt.Fprintln(term, "Warning: Wrong room password! Try again.")
+			}
+			join.Secret = askLimited(input, "Room password: ", "Password", protocol.MaxSecretLength)
+		default:
+			return protocol.Ack{}, err
+		}
+	}
+}
+
+// entered remembers the room we got into with join as username
+func (s *session) entered(ack protocol.Ack, join protocol.Join, username string) {
+	historyPending = ack.History
+	historyOffline = ack.Offline
+	historyDropped = ack.Dropped
+	roomMembers = ack.Members
+
+	// The server may have added a number to a taken name
+	if ack.Username != "" && ack.Username != username {
+		fmt.Fprintln(term, "*** The name", username, "is taken in this room, you are", ack.Username)
+		username = ack.Username
+	}
+
+	s.mu.Lock()
+	s.username = username
+	s.join = join
+	s.join.Code = ack.Room
+	s.join.Username = ""
+	s.join.ResumeToken = ack.ResumeToken
+	s.mu.Unlock()
+
+	s.noteMemberToken(ack.MemberToken)
+}
+
+// RoomCode is the code of the room we are in (or last left)
+func (s *session) RoomCode() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.join.Code
+}
+
+// noteMemberToken keeps the member token the server sends when we first
+// join a persistent room under this name, and shows it to the user
+func (s *session) noteMemberToken(token string) {
+	if token == "" {
+		return
+	}
+	s.mu.Lock()
+	s.join.MemberToken = token
+	s.mu.Unlock()
+
+	fmt.Fprintln(term, "*** You are now a member of this room. Member token (keep it, do NOT share):")
+	fmt.Fprintln(term, "***  ", token)
+	fmt.Fprintln(term, "*** Rejoin with -member-token=... to get the messages sent while you were away")
+}
+
+// askEncryptionKey asks until the answer is a valid room key
+func askEncryptionKey(input *bufio.Reader) string {
+	for {
+		key := askLine(input, "Enter encryption key: ")
+		if IsValidKey(key) {
+			return key
+		}
+		fmt.Fprintln(term, "Warning: Invalid key format! Must be 44 characters (Base64). Try again.")
+	}
+}
+
+// printArrival says who is here and what is about to be replayed
+func printArrival() {
+	printMemberCount()
+
+	if historyDropped > 0 {
+		fmt.Fprintf(term, "--- %d message(s) sent while you were away could not be kept ---\n", historyDropped)
+	}
+	if historyPending > 0 && historyOffline {
+		fmt.Fprintf(term, "--- %d message(s) sent while you were away ---\n", historyPending)
+	} else if historyPending > 0 {
+		fmt.Fprintf(term, "--- %d earlier message(s) ---\n", historyPending)
+	}
+}
+
+// InRoom reports whether we are in a room (not after /leave)
+func (s *session) InRoom() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return !s.left
+}
+
+// leave closes the connection and stops reconnecting
+//
+// The server is told first, so that it doesn't keep our name for a
+// reconnect that won't come.
+func (s *session) leave() {
+	s.Send(protocol.TypeLeave, struct{}{})
+
+	s.mu.Lock()
+	s.left = true
+	s.back = make(chan struct{})
+	s.parked = make(chan struct{})
+	close(s.leaving)
+	conn := s.conn
+	s.mu.Unlock()
+
+	conn.Close()
+	typing.reset()
+}
+
+// waitForRoom is called by the receiving goroutine when reading from
+// failed broke. After /leave it waits for the next /join.
+//
+// Returns true if a new connection has replaced failed (nothing to
+// reconnect), false if the connection was lost.
+func (s *session) waitForRoom(failed net.Conn) bool {
+	s.mu.Lock()
+	left, parked, back := s.left, s.parked, s.back
+	s.mu.Unlock()
+
+	if left {
+		close(parked)
+		<-back
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.conn != failed
+}
+
+// switchRoom leaves the current room, if any, and enters the room code
+func (s *session) switchRoom(code string) {
+	if s.InRoom() {
+		s.leave()
+		fmt.Fprintln(term, "*** You left room", s.RoomCode())
+	}
+
+	// The receiving goroutine may still be printing the old room or
+	// reconnecting to it: wait until it lets go of the session
+	s.mu.Lock()
+	parked := s.parked
+	s.mu.Unlock()
+	<-parked
+
+	fmt.Fprintln(term, "*** Connecting to", s.address, "...")
+	conn, err := dialServer(s.address, s.tlsConfig)
+	if err != nil {
+		fmt.Fprintln(term, "*** Connection failed:", err)
+		return
+	}
+	reader := bufio.NewReader(conn)
+
+	username := s.Username()
+	hello, err := handshake(conn, reader, username)
+	if err != nil {
+		conn.Close()
+		fmt.Fprintln(term, "*** Handshake failed:", err)
+		return
+	}
+
+	join := protocol.Join{Code: code}
+	ack, err := s.enterRoom(conn, reader, hello, &join, &username, false)
+	if err != nil {
+		conn.Close()
+		fmt.Fprintln(term, "*** Could not join:", err)
+		return
+	}
+
+	direct.reset()
+	s.entered(ack, join, username)
+	key := askEncryptionKey(s.input)
+	fmt.Fprintln(term, "*** Joined room", ack.Room, "(encrypted)")
+	printArrival()
+
+	// A new room: nothing of the old one applies. Hand the connection
+	// over to the receiving goroutine.
+	s.mu.Lock()
+	s.conn, s.reader, s.hello = conn, reader, hello
+	s.key = key
+	s.lastSeq = 0
+	s.stayAway = false
+	s.retryAfter = 0
+	s.left = false
+	s.leaving = make(chan struct{})
+	close(s.back)
+	s.mu.Unlock()
+
+	if protocol.HasCapability(hello.Capabilities, protocol.CapHeartbeat) {
+		startHeartbeat(conn)
+	}
+}
@@ -0,0 +1,315 @@
+package main
+
+// ============================================================
+// AUTOMATIC RECONNECT
+// ============================================================
+//
+// When the connection drops, the client dials again with growing pauses
+// (1s, 2s, 4s ... up to 30s) and rejoins the same room under the same
+// username. The last ack's resume token lets it back in without the
+// password or the owner's approval, and LastSeq tells the server which
+// messages we already have, so only the missed ones are replayed.
+//
+// The encryption key never leaves memory, so nothing has to be typed
+// again. We do not reconnect after being kicked or after the room was
+// closed by the operator.
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"messenger-protocol"
+)
+
+const (
+	reconnectFirstDelay = 1 * time.Second
+	reconnectMaxDelay   = 30 * time.Second
+)
+
+// autoReconnect is switched off with -reconnect=false
+var autoReconnect = true
+
+// session is everything needed to get back into the room
+//
+// The input loop (commands, /join) and the receiving goroutine
+// (reconnect) both use it, so everything that changes with the
+// connection or the room is kept under mu.
+type session struct {
+	address   string
+	tlsConfig *tls.Config
+	input     *bufio.Reader // the keyboard, for the questions of /join
+
+	mu         sync.Mutex
+	conn       net.Conn
+	reader     *bufio.Reader
+	hello      protocol.Hello // the server's hello on conn: capabilities, limits
+	username   string
+	join       protocol.Join // code, password, owner, resume and member tokens
+	key        string        // the room's encryption key (Base64)
+	lastSeq    uint64        // the newest room message we have seen
+	stayAway   bool          // the server told us not to come back (kicked, room closed)
+	retryAfter time.Duration // the server's shutdown hint for the first retry
+	left       bool          // out of the room after /leave (join.go)
+	leaving    chan struct{} // closed by /leave: stop reconnecting
+	parked     chan struct{} // closed when the receiving goroutine waits for /join
+	back       chan struct{} // closed when /join brings us into a room
+}
+
+// Username is our name in the room (it changes with /nick)
+func (s *session) Username() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.username
+}
+
+// Can reports whether both we and the server support capability
+func (s *session) Can(capability string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return protocol.HasCapability(s.hello.Capabilities, capability)
+}
+
+// MaxMessage is the largest encrypted chat body the server relays
+func (s *session) MaxMessage() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.hello.MaxMessage > 0 {
+		return s.hello.MaxMessage
+	}
+	return defaultMaxMessage
+}
+
+// Key is the room's encryption key
+func (s *session) Key() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.key
+}
+
+// seen remembers seq as read, so that a reconnect replays only what
+// came after it
+func (s *session) seen(seq uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if seq > s.lastSeq {
+		s.lastSeq = seq
+	}
+}
+
+// Send writes one frame to the current connection
+func (s *session) Send(t protocol.Type, v interface{}) error {
+	s.mu.Lock()
+	conn := s.conn
+	s.mu.Unlock()
+
+	return protocol.Send(conn, t, v)
+}
+
+// receive reads frames forever, reconnecting whenever the connection drops
+func (s *session) receive() {
+	for {
+		s.mu.Lock()
+		conn, reader := s.conn, s.reader
+		heartbeat := protocol.HasCapability(s.hello.Capabilities, protocol.CapHeartbeat)
+		s.mu.Unlock()
+
+		if heartbeat {
+			extendDeadline(conn)
+		}
+
+		frame, err := protocol.ReadFrame(reader)
+		if err != nil {
+			// Not lost but closed by /leave or replaced by /join (join.go)
+			if s.waitForRoom(conn) {
+				continue
+			}
+			s.reconnect(err)
+			continue
+		}
+
+		switch frame.Type {
+		case protocol.TypePing:
+			answerPing(conn, frame)
+		case protocol.TypePong:
+			// only keeps the connection alive
+		case protocol.TypeSystem:
+			s.noteRename(frame)
+			s.printFrame(frame)
+		default:
+			// The frame type tells us what we got — no guessing by prefixes
+			s.printFrame(frame)
+		}
+	}
+}
+
+// reconnect retries until we are back in the room
+//
+// Exits the program if reconnecting is off or pointless. Returns early
+// if the user leaves the room meanwhile.
+func (s *session) reconnect(cause error) {
+	s.mu.Lock()
+	s.conn.Close()
+	stayAway, leaving := s.stayAway, s.leaving
+	delay := reconnectFirstDelay
+	if s.retryAfter > 0 {
+		delay = s.retryAfter
+		s.retryAfter = 0
+	}
+	s.mu.Unlock()
+
+	if !autoReconnect || stayAway {
+		connectionLost(cause)
+	}
+
+	fmt.Fprintln(term, "")
+	fmt.Fprintln(term, "*** Connection lost:", describeLoss(cause))
+
+	for attempt := 1; ; attempt++ {
+		fmt.Fprintf(term, "*** Reconnecting in %s...\n", delay)
+		select {
+		case <-time.After(delay):
+		case <-leaving:
+			return
+		}
+
+		ack, err := s.rejoin()
+		if err == nil {
+			reportResume(ack)
+			return
+		}
+		select {
+		case <-leaving:
+			// /leave meanwhile: whatever went wrong no longer matters
+			return
+		default:
+		}
+
+		var protoErr *protocol.Error
+		if errors.As(err, &protoErr) {
+			switch protoErr.Code {
+			case protocol.ErrTooManyAttempts, protocol.ErrRateLimited:
+				delay = time.Duration(protoErr.RetryAfter) * time.Second
+				continue
+			case protocol.ErrRoomFull, protocol.ErrServerFull, protocol.ErrOwnerOffline,
+				protocol.ErrTooManyConnections:
+				// may clear up by itself — keep trying
+			default:
+				fmt.Fprintln(term, "*** Could not rejoin the room:", protoErr.Message)
+				exit(1)
+			}
+		}
+
+		fmt.Fprintf(term, "*** Attempt %d failed: %v\n", attempt, err)
+		delay *= 2
+		if delay > reconnectMaxDelay {
+			delay = reconnectMaxDelay
+		}
+	}
+}
+
+// errLeft is returned by rejoin when /leave came first
+var errLeft = errors.New("left the room")
+
+// rejoin dials the server, repeats the handshake and joins the room again
+func (s *session) rejoin() (protocol.Ack, error) {
+	conn, err := dialServer(s.address, s.tlsConfig)
+	if err != nil {
+		return protocol.Ack{}, err
+	}
+	reader := bufio.NewReader(conn)
+
+	hello, err := handshake(conn, reader, s.Username())
+	if err != nil {
+		conn.Close()
+		return protocol.Ack{}, err
+	}
+
+	s.mu.Lock()
+	join := s.join
+	join.LastSeq = s.lastSeq
+	s.mu.Unlock()
+
+	if err := protocol.Send(conn, protocol.TypeJoin, join); err != nil {
+		conn.Close()
+		return protocol.Ack{}, err
+	}
+
+	ack, err := s.waitForAck(reader)
+	if err != nil {
+		conn.Close()
+		return protocol.Ack{}, err
+	}
+
+	s.mu.Lock()
+	if s.left {
+		// /leave while we were dialing: the new connection isn't wanted
+		s.mu.Unlock()
+		protocol.Send(conn, protocol.TypeLeave, struct{}{})
+		conn.Close()
+		return protocol.Ack{}, errLeft
+	}
+	if ack.Username != "" {
+		s.username = ack.Username
+	}
+	s.conn, s.reader, s.hello = conn, reader, hello
+	s.join.ResumeToken = ack.ResumeToken
+	s.mu.Unlock()
+
+	s.noteMemberToken(ack.MemberToken)
+
+	if protocol.HasCapability(hello.Capabilities, protocol.CapHeartbeat) {
+		startHeartbeat(conn)
+	}
+	return ack, nil
+}
+
+// reportResume tells the user what they may have missed
+func reportResume(ack protocol.Ack) {
+	fmt.Fprintln(term, "*** Reconnected to room", ack.Room)
+
+	historyPending = ack.History
+	historyOffline = ack.Offline
+
+	switch {
+	case !ack.Resumed:
+		fmt.Fprintln(term, "--- Could not resume the session: messages sent while you were disconnected may be missing ---")
+		if ack.History > 0 {
+			fmt.Fprintf(term, "--- %d earlier message(s) ---\n", ack.History)
+		}
+	case ack.History == 0 && ack.Dropped == 0:
+		fmt.Fprintln(term, "--- You did not miss any messages ---")
+	default:
+		if ack.Dropped > 0 {
+			fmt.Fprintf(term, "--- %d message(s) sent while you were disconnected could not be recovered ---\n", ack.Dropped)
+		}
+		if ack.History > 0 {
+			fmt.Fprintf(term, "--- %d message(s) you missed ---\n", ack.History)
+		}
+	}
+}
+
+// noteRename picks up our new name after /nick, so that reconnecting
+// (and the resume token, which moved with it) uses the new one
+func (s *session) noteRename(frame protocol.Frame) {
+	var sys protocol.System
+	if err := frame.Decode(&sys); err != nil || sys.Event != protocol.EventRenamed {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if sys.Previous == s.username {
+		s.username = sys.Username
+	}
+}
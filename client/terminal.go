@@ -0,0 +1,300 @@
+package main
+
+// ============================================================
+// TERMINAL: LINE EDITOR AND STATUS LINE
+// ============================================================
+//
+// Normally the terminal collects a whole line and hands it over on
+// Enter, so the client can't tell that someone is typing. When stdin is
+// a terminal (and stty is available), the chat switches it to
+// character-at-a-time mode and edits the line itself:
+//
+//   - every change of the input is reported (typing indicators)
+//   - the bottom line shows a status, e.g. "(alice is typing…)",
+//     followed by what you are typing
+//   - incoming messages are printed above that line, which is then
+//     redrawn, so they no longer cut through your half-typed text
+//   - Tab completes commands (see commands.go)
+//
+// Everything the client prints is written to term (fmt.Fprintln(term,
+// ...)), which puts it above the input line and redraws that. os.Stdout
+// itself is never replaced, so the goroutines that print (receiving,
+// reconnecting) don't race with Start and Stop.
+// Without a terminal (input from a pipe, Windows) lines are read as before.
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"unicode"
+)
+
+// Keys the line editor understands
+const (
+	keyCtrlC     = 3
+	keyCtrlD     = 4
+	keyBackspace = 8
+	keyTab       = 9
+	keyCtrlU     = 21
+	keyCtrlW     = 23
+	keyEscape    = 27
+	keyDelete    = 127
+)
+
+// console is the chat screen: input line, status and output
+type console struct {
+	mu sync.Mutex
+
+	raw   bool   // the terminal is in character mode
+	saved string // "stty -g" state to restore
+
+	line   []rune // what is being typed
+	status string // shown before the input, e.g. "alice is typing…"
+	prompt string // question being answered (Ask), shown before the input
+
+	// onChange is called (without mu) after every edit of the input line
+	onChange func(empty bool)
+
+	// complete, if set, returns the input line completed on Tab
+	// (called without mu, may print)
+	complete func(line string) string
+}
+
+var term = &console{}
+
+// Start switches the terminal to character mode if stdin is a terminal
+func (c *console) Start() {
+	saved, err := stty("-g")
+	if err != nil {
+		return // not a terminal, or no stty
+	}
+	if _, err := stty("-icanon", "-echo", "min", "1", "time", "0"); err != nil {
+		return
+	}
+
+	c.mu.Lock()
+	c.raw = true
+	c.saved = saved
+	c.mu.Unlock()
+
+	// Ctrl+C must not leave the terminal without echo
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		exit(130)
+	}()
+}
+
+// Stop gives the terminal back
+func (c *console) Stop() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.raw {
+		return
+	}
+	c.raw = false
+	fmt.Fprint(os.Stdout, "\r\033[K")
+	stty(c.saved)
+}
+
+// Write prints p above the input line and redraws the line
+//
+// Everything the client prints goes through here.
+func (c *console) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.raw {
+		return os.Stdout.Write(p)
+	}
+	fmt.Fprint(os.Stdout, "\r\033[K"+string(p))
+	if bytes.HasSuffix(p, []byte("\n")) {
+		c.redraw()
+	}
+	return len(p), nil
+}
+
+// SetStatus changes the status shown before the input line
+func (c *console) SetStatus(status string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if status == c.status {
+		return
+	}
+	c.status = status
+	if c.raw {
+		c.redraw()
+	}
+}
+
+// Clear clears the screen, keeping the input line
+func (c *console) Clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	fmt.Fprint(os.Stdout, "\033[H\033[2J")
+	if c.raw {
+		c.redraw()
+	}
+}
+
+// Raw reports whether the line editor is active
+func (c *console) Raw() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.raw
+}
+
+// redraw repaints the input line (under mu)
+func (c *console) redraw() {
+	prefix := ""
+	if c.status != "" {
+		prefix = "(" + c.status + ") "
+	}
+	fmt.Fprint(os.Stdout, "\r\033[K"+prefix+c.prompt+string(c.line))
+}
+
+// Ask shows question and returns the answer, without the newline
+func (c *console) Ask(input *bufio.Reader, question string) (string, error) {
+	if !c.Raw() {
+		fmt.Fprint(c, question)
+		return input.ReadString('\n')
+	}
+
+	c.mu.Lock()
+	c.prompt = question
+	c.redraw()
+	c.mu.Unlock()
+
+	defer func() {
+		c.mu.Lock()
+		c.prompt = ""
+		c.redraw()
+		c.mu.Unlock()
+	}()
+	return c.ReadLine(input)
+}
+
+// ReadLine returns the next line of input, without the newline
+func (c *console) ReadLine(input *bufio.Reader) (string, error) {
+	if !c.Raw() {
+		return input.ReadString('\n')
+	}
+
+	for {
+		r, _, err := input.ReadRune()
+		if err != nil {
+			return "", err
+		}
+
+		changed := true
+
+		c.mu.Lock()
+		switch {
+		case r == '\r' || r == '\n':
+			// Leave the line on screen as it was typed
+			line := string(c.line)
+			c.line = c.line[:0]
+			fmt.Fprint(os.Stdout, "\r\033[K"+c.prompt+line+"\n")
+			c.redraw()
+			c.mu.Unlock()
+			return line, nil
+
+		case r == keyCtrlD && len(c.line) == 0:
+			c.mu.Unlock()
+			return "", io.EOF
+
+		case r == keyCtrlC:
+			c.mu.Unlock()
+			exit(130)
+
+		case r == keyBackspace || r == keyDelete:
+			if len(c.line) > 0 {
+				c.line = c.line[:len(c.line)-1]
+			} else {
+				changed = false
+			}
+
+		case r == keyTab && c.complete != nil:
+			line := string(c.line)
+			c.mu.Unlock()
+			completed := c.complete(line)
+			c.mu.Lock()
+			changed = completed != line
+			c.line = []rune(completed)
+
+		case r == keyCtrlU:
+			c.line = c.line[:0]
+
+		case r == keyCtrlW:
+			// Delete the last word
+			end := len(c.line)
+			for end > 0 && c.line[end-1] == ' ' {
+				end--
+			}
+			for end > 0 && c.line[end-1] != ' ' {
+				end--
+			}
+			c.line = c.line[:end]
+
+		case r == keyEscape:
+			// Arrow keys and the like: skip the whole escape sequence
+			c.mu.Unlock()
+			skipEscape(input)
+			continue
+
+		case unicode.IsPrint(r):
+			c.line = append(c.line, r)
+
+		default:
+			changed = false
+		}
+
+		empty := len(c.line) == 0
+		c.redraw()
+		c.mu.Unlock()
+
+		if changed && c.onChange != nil {
+			c.onChange(empty)
+		}
+	}
+}
+
+// skipEscape reads the rest of an "ESC [ ... letter" sequence
+func skipEscape(input *bufio.Reader) {
+	b, err := input.ReadByte()
+	if err != nil || (b != '[' && b != 'O') {
+		return
+	}
+	for {
+		b, err := input.ReadByte()
+		if err != nil || (b >= 0x40 && b <= 0x7e) {
+			return
+		}
+	}
+}
+
+// stty runs stty on our terminal
+func stty(args ...string) (string, error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = os.Stdin
+	out, err := cmd.Output()
+	return strings.TrimSpace(string(out)), err
+}
+
+// exit restores the terminal and ends the program
+func exit(code int) {
+	term.Stop()
+	os.Exit(code)
+}
@@ -0,0 +1,163 @@
+package main
+
+// ============================================================
+// TLS TRANSPORT
+// CA verification or trust-on-first-use certificate pinning
+// ============================================================
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// dialServer opens the connection to the server
+//
+// Without tlsConfig this is a plain TCP connection.
+func dialServer(address string, tlsConfig *tls.Config) (net.Conn, error) {
+	if tlsConfig == nil {
+		return net.Dial("tcp", address)
+	}
+
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	return tls.DialWithDialer(dialer, "tcp", address, tlsConfig)
+}
+
+// newTLSConfig builds the client TLS settings
+//
+// Two modes:
+//   - caFile set: the server certificate must be signed by that CA
+//     (normal hostname verification applies)
+//   - caFile empty: trust on first use — the certificate fingerprint is
+//     saved to knownHostsFile on the first connection and must match
+//     on every connection after that
+func newTLSConfig(address, caFile, knownHostsFile string) (*tls.Config, error) {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+
+	if caFile != "" {
+		pemData, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pemData) {
+			return nil, fmt.Errorf("no certificates found in %s", caFile)
+		}
+
+		return &tls.Config{
+			RootCAs:    pool,
+			ServerName: host,
+			MinVersion: tls.VersionTLS12,
+		}, nil
+	}
+
+	// TOFU: we do the verification ourselves in VerifyPeerCertificate,
+	// so the standard chain check is switched off
+	return &tls.Config{
+		InsecureSkipVerify: true,
+		MinVersion:         tls.VersionTLS12,
+		VerifyPeerCertificate: func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			if len(rawCerts) == 0 {
+				return errors.New("server sent no certificate")
+			}
+			return verifyPinned(knownHostsFile, address, fingerprint(rawCerts[0]))
+		},
+	}, nil
+}
+
+// ============================================================
+// KNOWN HOSTS (TOFU)
+// ============================================================
+
+// defaultKnownHostsFile returns ~/.messenger/known_hosts
+func defaultKnownHostsFile() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "known_hosts"
+	}
+	return filepath.Join(home, ".messenger", "known_hosts")
+}
+
+// fingerprint returns the SHA-256 of a DER certificate as hex
+//
+// This matches what the server prints at startup.
+func fingerprint(der []byte) string {
+	sum := sha256.Sum256(der)
+	return hex.EncodeToString(sum[:])
+}
+
+// verifyPinned compares a fingerprint with the one stored for address
+//
+// File format, one server per line:
+//
+//	host:port sha256-hex
+func verifyPinned(knownHostsFile, address, got string) error {
+	pinned, err := lookupKnownHost(knownHostsFile, address)
+	if err != nil {
+		return err
+	}
+
+	if pinned == "" {
+		// First connection to this server — remember it
+		fmt.Fprintln(term, "First TLS connection to", address)
+		fmt.Fprintln(term, "  Certificate fingerprint (SHA-256):", got)
+		fmt.Fprintln(term, "  Compare it with the one printed by the server. Saved to", knownHostsFile)
+		return addKnownHost(knownHostsFile, address, got)
+	}
+
+	if pinned != got {
+		return fmt.Errorf("server certificate for %s has CHANGED (expected %s, got %s) — "+
+			"someone may be impersonating the server; if the change is legitimate remove the entry from %s",
+			address, pinned, got, knownHostsFile)
+	}
+
+	return nil
+}
+
+func lookupKnownHost(knownHostsFile, address string) (string, error) {
+	f, err := os.Open(knownHostsFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && fields[0] == address {
+			return fields[1], nil
+		}
+	}
+	return "", scanner.Err()
+}
+
+func addKnownHost(knownHostsFile, address, fp string) error {
+	if err := os.MkdirAll(filepath.Dir(knownHostsFile), 0700); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(knownHostsFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = fmt.Fprintf(f, "%s %s\n", address, fp)
+	return err
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// selfSigned makes a certificate like the one the server generates on first run
+func selfSigned(t *testing.T) tls.Certificate {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: "messenger-server"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// tlsServer accepts TLS connections on a local port and presents
+// whatever certificate is stored in cert at the time
+func tlsServer(t *testing.T, cert *atomic.Value) string {
+	t.Helper()
+
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			c := cert.Load().(tls.Certificate)
+			return &c, nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conn.(*tls.Conn).Handshake()
+			conn.Close()
+		}
+	}()
+	return listener.Addr().String()
+}
+
+// dialTOFU connects the way the client does without -ca
+func dialTOFU(address, knownHosts string) error {
+	config, err := newTLSConfig(address, "", knownHosts)
+	if err != nil {
+		return err
+	}
+	conn, err := dialServer(address, config)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+func TestTrustOnFirstUse(t *testing.T) {
+	knownHosts := filepath.Join(t.TempDir(), ".messenger", "known_hosts")
+
+	first := selfSigned(t)
+	var cert atomic.Value
+	cert.Store(first)
+	address := tlsServer(t, &cert)
+
+	// First contact: accepted and remembered
+	if err := dialTOFU(address, knownHosts); err != nil {
+		t.Fatalf("first connection: %v", err)
+	}
+	data, err := os.ReadFile(knownHosts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := address + " " + fingerprint(first.Certificate[0]) + "\n"
+	if string(data) != want {
+		t.Fatalf("known_hosts = %q, want %q", data, want)
+	}
+	if info, err := os.Stat(knownHosts); err == nil && info.Mode().Perm() != 0600 {
+		t.Errorf("known_hosts mode = %v, want 0600", info.Mode().Perm())
+	}
+
+	// Same certificate: accepted, nothing added
+	if err := dialTOFU(address, knownHosts); err != nil {
+		t.Fatalf("same certificate rejected: %v", err)
+	}
+	if again, _ := os.ReadFile(knownHosts); string(again) != want {
+		t.Errorf("known_hosts changed to %q", again)
+	}
+
+	// The server now shows another certificate: refused
+	cert.Store(selfSigned(t))
+	err = dialTOFU(address, knownHosts)
+	if err == nil {
+		t.Fatal("changed certificate accepted")
+	}
+	if !strings.Contains(err.Error(), "has CHANGED") || !strings.Contains(err.Error(), fingerprint(first.Certificate[0])) {
+		t.Errorf("error = %v, want the mismatch error with the pinned fingerprint", err)
+	}
+	if again, _ := os.ReadFile(knownHosts); string(again) != want {
+		t.Errorf("known_hosts changed to %q after a mismatch", again)
+	}
+}
+
+func TestVerifyPinned(t *testing.T) {
+	knownHosts := filepath.Join(t.TempDir(), "known_hosts")
+	content := "# comment line\n" +
+		"example.com:9000 aaaa\n" +
+		"broken line with too many fields\n" +
+		"chat.example.com:9000 bbbb\n"
+	if err := os.WriteFile(knownHosts, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		address string
+		got     string
+		wantErr bool
+	}{
+		{"pinned match", "example.com:9000", "aaaa", false},
+		{"pinned mismatch", "example.com:9000", "bbbb", true},
+		{"other entry", "chat.example.com:9000", "bbbb", false},
+		{"same host, other port is a new server", "example.com:9001", "cccc", false},
+		{"remembered after first contact", "example.com:9001", "cccc", false},
+		{"then pinned", "example.com:9001", "dddd", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := verifyPinned(knownHosts, tt.address, tt.got)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("verifyPinned(%s, %s) = %v, want error: %v", tt.address, tt.got, err, tt.wantErr)
+			}
+		})
+	}
+
+	data, err := os.ReadFile(knownHosts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := content + "example.com:9001 cccc\n"; string(data) != want {
+		t.Errorf("known_hosts = %q, want %q", data, want)
+	}
+}
@@ -0,0 +1,209 @@
+package main
+
+// ============================================================
+// TYPING INDICATORS
+// ============================================================
+//
+// While you edit the input line (see terminal.go) the client tells the
+// room "typing" — at most once every typingRefresh, and "stopped" when
+// the line is cleared. Only the fact of typing is sent, never the text.
+//
+// Other people's indicators are shown in the status line and expire
+// after typingTimeout without a refresh, or as soon as their message
+// arrives. -typing=false turns both directions off.
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"messenger-protocol"
+)
+
+const (
+	typingRefresh = 3 * time.Second
+	typingTimeout = 6 * time.Second
+)
+
+// typingEnabled is switched off with -typing=false
+var typingEnabled = true
+
+// typingState is both our own indicator and everyone else's
+type typingState struct {
+	mu sync.Mutex
+
+	// ours
+	sess     *session
+	active   bool
+	lastSent time.Time
+
+	// theirs: username → when the indicator expires
+	others map[string]time.Time
+	shown  string // last status printed without the line editor
+}
+
+var typing = &typingState{others: make(map[string]time.Time)}
+
+// start hooks typing into the line editor and expires old indicators
+func (t *typingState) start(sess *session) {
+	if !typingEnabled || !sess.Can(protocol.CapTyping) {
+		return
+	}
+
+	t.mu.Lock()
+	t.sess = sess
+	t.mu.Unlock()
+
+	term.onChange = t.inputChanged
+
+	go func() {
+		for range time.Tick(time.Second) {
+			t.expire()
+		}
+	}()
+}
+
+// inputChanged is called by the line editor after every edit
+func (t *typingState) inputChanged(empty bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	switch {
+	case !empty && (!t.active || time.Since(t.lastSent) >= typingRefresh):
+		t.send(true)
+	case empty && t.active:
+		t.send(false)
+	}
+}
+
+// lineSent resets our indicator once a line was entered
+//
+// A chat message ends the indicator by itself on the other side;
+// after a command we say so explicitly.
+func (t *typingState) lineSent(chat bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if !t.active {
+		return
+	}
+	if chat {
+		t.active = false
+		return
+	}
+	t.send(false)
+}
+
+// send tells the server whether we are typing (under mu)
+func (t *typingState) send(active bool) {
+	if t.sess == nil {
+		return
+	}
+	t.active = active
+	t.lastSent = time.Now()
+	t.sess.Send(protocol.TypeTyping, protocol.Typing{Active: active})
+}
+
+// received handles someone else's indicator
+func (t *typingState) received(ev protocol.Typing) {
+	if !typingEnabled {
+		return
+	}
+
+	t.mu.Lock()
+	if ev.Active {
+		t.others[ev.Username] = time.Now().Add(typingTimeout)
+	} else {
+		delete(t.others, ev.Username)
+	}
+	t.mu.Unlock()
+
+	t.show()
+}
+
+// stopped forgets username's indicator (they sent a message or left)
+func (t *typingState) stopped(username string) {
+	t.mu.Lock()
+	_, ok := t.others[username]
+	delete(t.others, username)
+	t.mu.Unlock()
+
+	if ok {
+		t.show()
+	}
+}
+
+// reset forgets all indicators when we leave a room
+func (t *typingState) reset() {
+	t.mu.Lock()
+	t.active = false
+	t.others = make(map[string]time.Time)
+	t.mu.Unlock()
+
+	t.show()
+}
+
+// expire drops indicators that were not refreshed in time
+func (t *typingState) expire() {
+	now := time.Now()
+	expired := false
+
+	t.mu.Lock()
+	for username, until := range t.others {
+		if now.After(until) {
+			delete(t.others, username)
+			expired = true
+		}
+	}
+	t.mu.Unlock()
+
+	if expired {
+		t.show()
+	}
+}
+
+// show puts the current indicators into the status line
+//
+// Without the line editor the status is printed as a normal line,
+// only when it changes to something new.
+func (t *typingState) show() {
+	t.mu.Lock()
+	names := make([]string, 0, len(t.others))
+	for username := range t.others {
+		names = append(names, username)
+	}
+	t.mu.Unlock()
+
+	sort.Strings(names)
+	status := describeTyping(names)
+
+	if term.Raw() {
+		term.SetStatus(status)
+		return
+	}
+
+	t.mu.Lock()
+	changed := status != t.shown
+	t.shown = status
+	t.mu.Unlock()
+
+	if changed && status != "" {
+		fmt.Fprintln(term, "***", status)
+	}
+}
+
+// describeTyping: "alice is typing…", "alice and bob are typing…", ...
+func describeTyping(names []string) string {
+	switch len(names) {
+	case 0:
+		return ""
+	case 1:
+		return names[0] + " is typing…"
+	case 2, 3:
+		return strings.Join(names[:len(names)-1], ", ") + " and " + names[len(names)-1] + " are typing…"
+	default:
+		return fmt.Sprintf("%d people are typing…", len(names))
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+// ============================================================
+// MEMBER LIST (/who)
+// ============================================================
+//
+// "/who" asks the server who is in the room right now. The answer
+// arrives like any other frame and is printed by printFrame.
+
+import (
+	"fmt"
+	"time"
+
+	"messenger-protocol"
+)
+
+// roomMembers is the member count from the join ack (including us)
+var roomMembers int
+
+func init() {
+	registerCommand(&command{
+		name: "who",
+		help: "List the people in the room",
+		run: func(sess *session, args string) {
+			requestWho(sess)
+		},
+	})
+}
+
+// requestWho asks the server for the member list
+func requestWho(sess *session) {
+	if !sess.Can(protocol.CapWho) {
+		fmt.Fprintln(term, "*** This server can't list the room's members")
+		return
+	}
+	if err := sess.Send(protocol.TypeWho, protocol.Who{}); err != nil {
+		fmt.Fprintln(term, "*** Not connected, try again later")
+	}
+}
+
+// printMembers prints the server's answer to /who
+func printMembers(who protocol.Who) {
+	if who.Total > len(who.Members) {
+		fmt.Fprintf(term, "--- %d in the room, showing the first %d ---\n", who.Total, len(who.Members))
+	} else {
+		fmt.Fprintf(term, "--- %d in the room ---\n", len(who.Members))
+	}
+
+	for _, m := range who.Members {
+		name := m.Username
+		if m.Owner {
+			name += " (owner)"
+		}
+
+		status := describeIdle(m.Idle)
+		switch {
+		case m.Away && m.Idle < 60:
+			status = "away"
+		case m.Away:
+			status += ", away"
+		}
+
+		joined := time.Unix(m.JoinedAt, 0).Format("15:04")
+		fmt.Fprintf(term, "  %-24s joined %s  %s\n", name, joined, status)
+	}
+}
+
+// printMemberCount tells a new arrival how many people are here
+func printMemberCount() {
+	switch {
+	case roomMembers == 1:
+		fmt.Fprintln(term, "--- You are the only one in the room ---")
+	case roomMembers > 1:
+		fmt.Fprintf(term, "--- %d people in the room, type /who to see who ---\n", roomMembers)
+	}
+}
+
+// describeIdle turns idle seconds into "active", "idle 7m" or "idle 2h05m"
+func describeIdle(seconds int64) string {
+	switch {
+	case seconds < 60:
+		return "active"
+	case seconds < 3600:
+		return fmt.Sprintf("idle %dm", seconds/60)
+	default:
+		return fmt.Sprintf("idle %dh%02dm", seconds/3600, seconds%3600/60)
+	}
+}
@@ -0,0 +1,3 @@
+module messenger-protocol
+
+go 1.18
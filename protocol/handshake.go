@@ -0,0 +1,93 @@
+package protocol
+
+// ============================================================
+// HANDSHAKE
+// Version and capability negotiation
+// ============================================================
+//
+// The client opens with a hello frame carrying its version range and
+// capabilities. The server answers with its own hello containing the
+// version both sides will speak and the capabilities both support, or
+// with an error frame (ErrIncompatibleVersion) and closes the connection.
+// Every later frame must carry a version from MinVersion up to the
+// negotiated one (Frame.CheckVersion).
+
+import (
+	"errors"
+	"fmt"
+)
+
+// MinVersion is the oldest protocol version this code can still speak
+const MinVersion uint8 = 1
+
+// ErrUnexpectedVersion is returned for a frame whose header carries a
+// version outside the range agreed in the handshake
+var ErrUnexpectedVersion = errors.New("unexpected protocol version")
+
+// Capabilities a peer may advertise in its hello
+const (
+	CapHistory   = "history"   // replay of recent messages on join
+	CapFiles     = "files"     // file transfer
+	CapTyping    = "typing"    // typing indicators
+	CapTLS       = "tls"       // connection is protected by TLS
+	CapHeartbeat = "heartbeat" // ping/pong keepalive and idle timeouts
+	CapWho       = "who"       // member list on request
+	CapDirect    = "direct"    // private messages to one member
+	CapNick      = "nick"      // changing the username while in a room
+)
+
+// Negotiate picks the protocol version for a peer that speaks
+// versions minVersion..version
+//
+// Returns an error if the two ranges don't overlap.
+func Negotiate(minVersion, version uint8) (uint8, error) {
+	// Old peers don't send MinVersion — treat it as "only this version"
+	if minVersion == 0 || minVersion > version {
+		minVersion = version
+	}
+
+	if version < MinVersion || minVersion > Version {
+		return 0, fmt.Errorf("incompatible protocol: peer speaks v%d-v%d, we speak v%d-v%d",
+			minVersion, version, MinVersion, Version)
+	}
+
+	// Highest version both sides understand
+	if version < Version {
+		return version, nil
+	}
+	return Version, nil
+}
+
+// CheckVersion reports whether f was sent with a version both sides
+// speak: from MinVersion up to negotiated, the version chosen in the
+// handshake
+//
+// The error wraps ErrUnexpectedVersion.
+func (f Frame) CheckVersion(negotiated uint8) error {
+	if f.Version >= MinVersion && f.Version <= negotiated {
+		return nil
+	}
+	return fmt.Errorf("%s frame has protocol v%d, expected v%d-v%d: %w",
+		f.Type, f.Version, MinVersion, negotiated, ErrUnexpectedVersion)
+}
+
+// CommonCapabilities returns the capabilities present in both lists
+func CommonCapabilities(ours, theirs []string) []string {
+	common := make([]string, 0)
+	for _, c := range ours {
+		if HasCapability(theirs, c) {
+			common = append(common, c)
+		}
+	}
+	return common
+}
+
+// HasCapability reports whether caps contains c
+func HasCapability(caps []string, c string) bool {
+	for _, have := range caps {
+		if have == c {
+			return true
+		}
+	}
+	return false
+}
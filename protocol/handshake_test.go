@@ -0,0 +1,72 @@
+package protocol
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		name                string
+		minVersion, version uint8
+		want                uint8
+		ok                  bool
+	}{
+		{"same version", MinVersion, Version, Version, true},
+		{"newer peer", MinVersion, Version + 1, Version, true},
+		{"old peer without min_version", 0, Version, Version, true},
+		{"peer too new", Version + 1, Version + 2, 0, false},
+		{"peer too old", 0, MinVersion - 1, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Negotiate(tt.minVersion, tt.version)
+			if (err == nil) != tt.ok {
+				t.Fatalf("Negotiate(%d, %d) error = %v, want ok = %v", tt.minVersion, tt.version, err, tt.ok)
+			}
+			if got != tt.want {
+				t.Errorf("Negotiate(%d, %d) = %d, want %d", tt.minVersion, tt.version, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckVersion(t *testing.T) {
+	tests := []struct {
+		version, negotiated uint8
+		ok                  bool
+	}{
+		{Version, Version, true},
+		{MinVersion, Version, true},
+		{0, Version, false},
+		{Version + 1, Version, false},
+	}
+
+	for _, tt := range tests {
+		err := Frame{Version: tt.version, Type: TypeChat}.CheckVersion(tt.negotiated)
+		if tt.ok && err != nil {
+			t.Errorf("v%d frame after negotiating v%d: %v", tt.version, tt.negotiated, err)
+		}
+		if !tt.ok && !errors.Is(err, ErrUnexpectedVersion) {
+			t.Errorf("v%d frame after negotiating v%d: got %v, want ErrUnexpectedVersion", tt.version, tt.negotiated, err)
+		}
+	}
+}
+
+func TestCommonCapabilities(t *testing.T) {
+	tests := []struct {
+		ours, theirs, want []string
+	}{
+		{[]string{CapHistory, CapWho}, []string{CapWho, CapTyping}, []string{CapWho}},
+		{[]string{CapHistory}, nil, []string{}},
+		{[]string{CapTLS, CapNick}, []string{CapNick, CapTLS}, []string{CapTLS, CapNick}},
+	}
+
+	for _, tt := range tests {
+		if got := CommonCapabilities(tt.ours, tt.theirs); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("CommonCapabilities(%v, %v) = %v, want %v", tt.ours, tt.theirs, got, tt.want)
+		}
+	}
+}
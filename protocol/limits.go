@@ -0,0 +1,121 @@
+package protocol
+
+// ============================================================
+// SIZE LIMITS
+// Enforced by both sides: frame payloads while reading, string
+// fields right after decoding
+// ============================================================
+
+import "fmt"
+
+// Field limits in bytes
+const (
+	MaxUsernameLength  = 4 * MaxUsernameRunes // UTF-8, see username.go
+	MaxCodeLength      = 128                  // the longest word codes are ~110 bytes
+	MaxSecretLength    = 256
+	MaxTokenLength     = 64
+	MaxPublicKeyLength = 128 // a P-256 point is 88 bytes in Base64
+)
+
+// payloadLimits caps control frames far below MaxPayloadSize — a hello
+// or join never needs more, so a peer can't make us buffer 64 KiB of it.
+// Types not listed (chat, ack, system, error) may use MaxPayloadSize.
+var payloadLimits = map[Type]int{
+	TypeHello:  4 * 1024,
+	TypeCreate: 1024,
+	TypeJoin:   1024,
+	TypeKnock:  512,
+	TypePing:   128,
+	TypePong:   128,
+	TypeTyping: 128,
+	TypeNick:   256,
+	TypeLeave:  128,
+}
+
+// PayloadLimit returns the largest payload allowed for frames of type t
+func PayloadLimit(t Type) int {
+	if n, ok := payloadLimits[t]; ok {
+		return n
+	}
+	return MaxPayloadSize
+}
+
+// FrameTooLargeError describes a frame rejected by its header
+//
+// errors.Is(err, ErrFrameTooLarge) is true for it.
+type FrameTooLargeError struct {
+	Type   Type
+	Length int
+	Limit  int
+}
+
+func (e *FrameTooLargeError) Error() string {
+	return fmt.Sprintf("%s frame too large: %d bytes (limit %d)", e.Type, e.Length, e.Limit)
+}
+
+func (e *FrameTooLargeError) Is(target error) bool {
+	return target == ErrFrameTooLarge
+}
+
+// checkLength returns a field_too_long error if value is longer than max
+func checkLength(field, value string, max int) error {
+	if len(value) > max {
+		return &Error{
+			Code:    ErrFieldTooLong,
+			Message: fmt.Sprintf("%s is too long (limit %d bytes)", field, max),
+		}
+	}
+	return nil
+}
+
+// CheckLimits reports the first field of h that is too long
+func (h Hello) CheckLimits() error {
+	if err := checkLength("username", h.Username, MaxUsernameLength); err != nil {
+		return err
+	}
+	return checkLength("public key", h.PublicKey, MaxPublicKeyLength)
+}
+
+// CheckLimits reports the first field of c that is too long
+func (c Create) CheckLimits() error {
+	return checkLength("room password", c.Secret, MaxSecretLength)
+}
+
+// CheckLimits reports the first field of j that is too long
+func (j Join) CheckLimits() error {
+	for _, err := range []error{
+		checkLength("username", j.Username, MaxUsernameLength),
+		checkLength("room code", j.Code, MaxCodeLength),
+		checkLength("room password", j.Secret, MaxSecretLength),
+		checkLength("owner token", j.OwnerToken, MaxTokenLength),
+		checkLength("resume token", j.ResumeToken, MaxTokenLength),
+		checkLength("member token", j.MemberToken, MaxTokenLength),
+	} {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CheckLimits reports the first field of w that is too long
+func (w Who) CheckLimits() error {
+	return checkLength("username", w.Username, MaxUsernameLength)
+}
+
+// CheckLimits reports the first field of k that is too long
+func (k Knock) CheckLimits() error {
+	return checkLength("username", k.Username, MaxUsernameLength)
+}
+
+// CheckLimits reports the first field of n that is too long
+func (n Nick) CheckLimits() error {
+	return checkLength("username", n.Username, MaxUsernameLength)
+}
+
+// CheckLimits reports the first field of d that is too long
+//
+// The body is limited by the server's message size instead.
+func (d Direct) CheckLimits() error {
+	return checkLength("username", d.To, MaxUsernameLength)
+}
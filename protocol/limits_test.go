@@ -0,0 +1,139 @@
+package protocol
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestPayloadLimit(t *testing.T) {
+	tests := []struct {
+		t    Type
+		want int
+	}{
+		{TypeHello, 4 * 1024},
+		{TypeCreate, 1024},
+		{TypeJoin, 1024},
+		{TypeKnock, 512},
+		{TypePing, 128},
+		{TypePong, 128},
+		{TypeTyping, 128},
+		{TypeNick, 256},
+		{TypeLeave, 128},
+		{TypeChat, MaxPayloadSize},
+		{TypeAck, MaxPayloadSize},
+		{TypeSystem, MaxPayloadSize},
+		{TypeError, MaxPayloadSize},
+		{Type(99), MaxPayloadSize},
+	}
+
+	for _, tt := range tests {
+		if got := PayloadLimit(tt.t); got != tt.want {
+			t.Errorf("PayloadLimit(%s) = %d, want %d", tt.t, got, tt.want)
+		}
+	}
+}
+
+func TestReadFramePerTypeLimits(t *testing.T) {
+	tests := []struct {
+		t      Type
+		length uint32
+		ok     bool
+	}{
+		{TypePing, 128, true},
+		{TypePing, 129, false},
+		{TypeJoin, 1024, true},
+		{TypeJoin, 1025, false},
+		{TypeHello, 4*1024 + 1, false},
+		{TypeChat, MaxPayloadSize, true},
+		{TypeChat, MaxPayloadSize + 1, false},
+	}
+
+	for _, tt := range tests {
+		data := append(header(Version, tt.t, tt.length), make([]byte, tt.length)...)
+		var r io.Reader = bytes.NewReader(data)
+		if !tt.ok {
+			// Too large: only the header may be read
+			r = &headerOnly{t: t, data: data[:HeaderSize]}
+		}
+
+		frame, err := ReadFrame(r)
+		if tt.ok {
+			if err != nil || len(frame.Payload) != int(tt.length) {
+				t.Errorf("%s with %d bytes: got %d bytes, %v", tt.t, tt.length, len(frame.Payload), err)
+			}
+			continue
+		}
+
+		var tooLarge *FrameTooLargeError
+		if !errors.As(err, &tooLarge) || !errors.Is(err, ErrFrameTooLarge) {
+			t.Errorf("%s with %d bytes: got %v, want FrameTooLargeError", tt.t, tt.length, err)
+			continue
+		}
+		if tooLarge.Type != tt.t || tooLarge.Length != int(tt.length) || tooLarge.Limit != PayloadLimit(tt.t) {
+			t.Errorf("%s with %d bytes: got %+v", tt.t, tt.length, tooLarge)
+		}
+	}
+}
+
+func TestReadFrameLimitedCustomLimit(t *testing.T) {
+	// A server may lower (or raise) limits per type, e.g. for chat
+	limit := func(t Type) int {
+		if t == TypeChat {
+			return 10
+		}
+		return PayloadLimit(t)
+	}
+
+	if _, err := ReadFrameLimited(bytes.NewReader(append(header(Version, TypeChat, 10), make([]byte, 10)...)), limit); err != nil {
+		t.Errorf("chat at the custom limit: %v", err)
+	}
+	r := &headerOnly{t: t, data: header(Version, TypeChat, 11)}
+	if _, err := ReadFrameLimited(r, limit); !errors.Is(err, ErrFrameTooLarge) {
+		t.Errorf("chat over the custom limit: got %v, want ErrFrameTooLarge", err)
+	}
+}
+
+func TestCheckLimits(t *testing.T) {
+	long := func(n int) string { return strings.Repeat("a", n) }
+
+	tests := []struct {
+		name string
+		msg  interface{ CheckLimits() error }
+		ok   bool
+	}{
+		{"hello", Hello{Username: long(MaxUsernameLength), PublicKey: long(MaxPublicKeyLength)}, true},
+		{"hello username", Hello{Username: long(MaxUsernameLength + 1)}, false},
+		{"hello public key", Hello{PublicKey: long(MaxPublicKeyLength + 1)}, false},
+		{"create", Create{Secret: long(MaxSecretLength)}, true},
+		{"create secret", Create{Secret: long(MaxSecretLength + 1)}, false},
+		{"join", Join{Code: long(MaxCodeLength), Secret: long(MaxSecretLength), OwnerToken: long(MaxTokenLength)}, true},
+		{"join code", Join{Code: long(MaxCodeLength + 1)}, false},
+		{"join username", Join{Username: long(MaxUsernameLength + 1)}, false},
+		{"join owner token", Join{OwnerToken: long(MaxTokenLength + 1)}, false},
+		{"join resume token", Join{ResumeToken: long(MaxTokenLength + 1)}, false},
+		{"join member token", Join{MemberToken: long(MaxTokenLength + 1)}, false},
+		{"knock", Knock{Username: long(MaxUsernameLength + 1)}, false},
+		{"nick", Nick{Username: long(MaxUsernameLength)}, true},
+		{"nick too long", Nick{Username: long(MaxUsernameLength + 1)}, false},
+		{"direct", Direct{To: "bob", Body: long(MaxPayloadSize)}, true},
+		{"direct recipient", Direct{To: long(MaxUsernameLength + 1)}, false},
+	}
+
+	for _, tt := range tests {
+		err := tt.msg.CheckLimits()
+		if tt.ok {
+			if err != nil {
+				t.Errorf("%s: %v", tt.name, err)
+			}
+			continue
+		}
+
+		var protoErr *Error
+		if !errors.As(err, &protoErr) || protoErr.Code != ErrFieldTooLong {
+			t.Errorf("%s: got %v, want %s", tt.name, err, ErrFieldTooLong)
+		}
+	}
+}
@@ -0,0 +1,320 @@
+package protocol
+
+// ============================================================
+// MESSAGE TYPES AND PAYLOADS
+// ============================================================
+
+import "fmt"
+
+// Type identifies what a frame carries
+type Type uint8
+
+const (
+	TypeHello  Type = iota + 1 // client → server: introduce yourself
+	TypeCreate                 // client → server: create a new room
+	TypeJoin                   // client → server: join an existing room
+	TypeChat                   // both ways: encrypted chat message
+	TypeSystem                 // server → client: join/leave notices
+	TypeError                  // server → client: request failed
+	TypeAck                    // server → client: request succeeded
+	TypeKnock                  // both ways: join request awaiting the owner
+	TypePing                   // both ways: are you still there?
+	TypePong                   // both ways: answer to a ping
+	TypeWho                    // client asks, server answers: who is in the room
+	TypeTyping                 // both ways: someone started/stopped typing
+	TypeDirect                 // both ways: private message to one member
+	TypeNick                   // client → server: change my username
+	TypeLeave                  // client → server: leaving on purpose, don't wait for me
+)
+
+// typeNames is used by String() for logs and error messages
+var typeNames = map[Type]string{
+	TypeHello:  "hello",
+	TypeCreate: "create",
+	TypeJoin:   "join",
+	TypeChat:   "chat",
+	TypeSystem: "system",
+	TypeError:  "error",
+	TypeAck:    "ack",
+	TypeKnock:  "knock",
+	TypePing:   "ping",
+	TypePong:   "pong",
+	TypeWho:    "who",
+	TypeTyping: "typing",
+	TypeDirect: "direct",
+	TypeNick:   "nick",
+	TypeLeave:  "leave",
+}
+
+func (t Type) String() string {
+	if name, ok := typeNames[t]; ok {
+		return name
+	}
+	return fmt.Sprintf("type(%d)", uint8(t))
+}
+
+// ============================================================
+// PAYLOADS
+// ============================================================
+
+// Hello opens the handshake (see handshake.go)
+//
+// Client → server: the client's version range, capabilities and username.
+// Server → client: the negotiated version and common capabilities,
+// plus a human-readable hint of the room code format ("8 digits")
+// and the largest chat body it relays (MaxMessage, bytes of ciphertext).
+//
+// PublicKey (client → server, "direct" capability) is the client's key
+// for private messages, see Direct.
+type Hello struct {
+	Version      uint8    `json:"version"`
+	MinVersion   uint8    `json:"min_version,omitempty"`
+	Capabilities []string `json:"capabilities"`
+	Username     string   `json:"username,omitempty"`
+	PublicKey    string   `json:"public_key,omitempty"`
+	CodeFormat   string   `json:"code_format,omitempty"`
+	MaxMessage   int      `json:"max_message,omitempty"`
+}
+
+// Create asks the server for a new room
+//
+// A persistent room is kept (and survives restarts when the server
+// has a file store) after the last member leaves.
+//
+// Secret is a join password checked by the server (unrelated to the
+// encryption key). Knock makes every join wait for the owner's approval.
+type Create struct {
+	Persistent bool   `json:"persistent,omitempty"`
+	Secret     string `json:"secret,omitempty"`
+	Knock      bool   `json:"knock,omitempty"`
+}
+
+// Join asks the server to enter an existing room
+//
+// OwnerToken (from the create ack) identifies the room owner,
+// who skips the knock and answers other people's knocks.
+//
+// ResumeToken (from the last ack) brings a dropped connection back into
+// the room without the password or knock; LastSeq is the last message
+// the client saw, so the server can send what was missed.
+//
+// MemberToken (from the first ack in a persistent room) proves that the
+// client is the member who owns this username; only then does it get
+// the messages queued while it was away.
+//
+// Username, if set, replaces the name from hello — e.g. a new name
+// after username_taken.
+type Join struct {
+	Code        string `json:"code"`
+	Username    string `json:"username,omitempty"`
+	Secret      string `json:"secret,omitempty"`
+	OwnerToken  string `json:"owner_token,omitempty"`
+	ResumeToken string `json:"resume_token,omitempty"`
+	MemberToken string `json:"member_token,omitempty"`
+	LastSeq     uint64 `json:"last_seq,omitempty"`
+}
+
+// Chat carries one encrypted message
+//
+// Body is opaque to the server (Base64 AES-GCM ciphertext).
+// From, Seq and Time are filled in by the server, whatever the client
+// sent. History marks messages replayed from the room backlog.
+type Chat struct {
+	From    string `json:"from,omitempty"`
+	Body    string `json:"body"`
+	Seq     uint64 `json:"seq,omitempty"`     // per-room sequence number
+	Time    int64  `json:"time,omitempty"`    // unix seconds when relayed
+	History bool   `json:"history,omitempty"` // replayed, not live
+}
+
+// System events
+const (
+	EventJoined   = "joined"
+	EventLeft     = "left"
+	EventWaiting  = "waiting"  // join request is waiting for the owner
+	EventNotice   = "notice"   // message from the server operator
+	EventKicked   = "kicked"   // you were removed by the operator
+	EventClosed   = "closed"   // the room was closed by the operator
+	EventShutdown = "shutdown" // the server is going down
+	EventRenamed  = "renamed"  // a member changed their username
+)
+
+// System is a notice generated by the server itself
+//
+// Only the server sends these, so a client can never make its
+// chat text look like a system message.
+type System struct {
+	Event    string `json:"event"`
+	Username string `json:"username,omitempty"`
+	Text     string `json:"text"`
+
+	// RetryAfter is a reconnect hint in seconds (shutdown only, 0 = unknown)
+	RetryAfter int `json:"retry_after,omitempty"`
+
+	// Previous is the old username (renamed only; Username is the new one)
+	Previous string `json:"previous,omitempty"`
+}
+
+// Error codes
+const (
+	ErrBadRequest          = "bad_request"
+	ErrIncompatibleVersion = "incompatible_version"
+	ErrUnknownCommand      = "unknown_command"
+	ErrRoomNotFound        = "room_not_found"
+	ErrInternal            = "internal_error"
+	ErrBadSecret           = "bad_secret"
+	ErrJoinRejected        = "join_rejected"
+	ErrOwnerOffline        = "owner_offline"
+	ErrTooManyAttempts     = "too_many_attempts"
+	ErrServerFull          = "server_full"
+	ErrRoomFull            = "room_full"
+	ErrMessageTooLarge     = "message_too_large"
+	ErrRateLimited         = "rate_limited"
+	ErrTooManyConnections  = "too_many_connections"
+	ErrOversizedFrame      = "frame_too_large"
+	ErrFieldTooLong        = "field_too_long"
+	ErrBadUsername         = "bad_username"
+	ErrUsernameTaken       = "username_taken"
+	ErrUserNotFound        = "user_not_found"
+)
+
+// Error reports a failed request
+//
+// RetryAfter (seconds) tells a throttled client when to try again
+// (too_many_attempts, rate_limited).
+type Error struct {
+	Code       string `json:"code"`
+	Message    string `json:"message"`
+	RetryAfter int    `json:"retry_after,omitempty"`
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Ack confirms a create or join request
+//
+// Username is the name the client has in the room. It differs from the
+// requested one only when the server added a suffix to a duplicate.
+//
+// History is the number of backlog chat frames that follow the ack.
+// Offline means the backlog is this member's offline queue (messages
+// sent while they were away) rather than the room history; Dropped
+// counts queued messages lost to size or age limits.
+//
+// Resumed means the join used a resume token: the backlog is exactly the
+// messages after the join's LastSeq, and Dropped counts the ones the
+// server no longer had.
+//
+// Members is how many people are in the room, including this client.
+//
+// OwnerToken is only sent to the creator of a room; it proves
+// ownership when they join again later. ResumeToken is new on every
+// ack and is only good for reconnecting to this room as this user.
+// MemberToken is sent once, when a username first becomes a member of
+// a persistent room; joins that present it get the offline queue.
+type Ack struct {
+	Room        string `json:"room"`
+	Username    string `json:"username,omitempty"`
+	OwnerToken  string `json:"owner_token,omitempty"`
+	ResumeToken string `json:"resume_token,omitempty"`
+	MemberToken string `json:"member_token,omitempty"`
+	Message     string `json:"message,omitempty"`
+	History     int    `json:"history,omitempty"`
+	Offline     bool   `json:"offline,omitempty"`
+	Resumed     bool   `json:"resumed,omitempty"`
+	Dropped     int    `json:"dropped,omitempty"`
+	Members     int    `json:"members,omitempty"`
+}
+
+// Knock is a join request in a room with owner approval
+//
+// Server → owner: Username wants to join.
+// Owner → server: let Username in (Accept) or turn them away.
+type Knock struct {
+	Username string `json:"username"`
+	Accept   bool   `json:"accept,omitempty"`
+}
+
+// Ping is a heartbeat; the peer answers with a Pong carrying the same Time
+//
+// Only sent when both sides have the "heartbeat" capability.
+// Time is the sender's clock in Unix milliseconds, so the sender can
+// measure the round trip when the pong comes back.
+type Ping struct {
+	Time int64 `json:"time"`
+}
+
+// Who asks for the member list (client → server) or carries it
+// (server → client)
+//
+// Only sent when both sides have the "who" capability. A request may
+// name one Username (any case) to ask about that member only, e.g. to
+// look up their public key. The server lists at most MaxWhoMembers
+// members; when it had to cut the list, Total is the full count.
+type Who struct {
+	Username string   `json:"username,omitempty"`
+	Members  []Member `json:"members,omitempty"`
+	Total    int      `json:"total,omitempty"`
+}
+
+// MaxWhoMembers is the longest member list in one who answer, so that it
+// always fits in a frame (a member takes at most ~400 bytes)
+const MaxWhoMembers = 100
+
+// Member is one person connected to the room
+//
+// Idle is the number of seconds since their last chat message (or since
+// they joined); Away means Idle is past the server's away threshold.
+// PublicKey is set for members who can receive private messages.
+type Member struct {
+	Username  string `json:"username"`
+	Owner     bool   `json:"owner,omitempty"`
+	JoinedAt  int64  `json:"joined_at"` // unix seconds
+	Idle      int64  `json:"idle"`
+	Away      bool   `json:"away,omitempty"`
+	PublicKey string `json:"public_key,omitempty"`
+}
+
+// Typing says that a member started or stopped typing a message
+//
+// Client → server: only Active. Server → other clients: Username is
+// filled in by the server. Carries no text, is never stored in the
+// history and only travels between peers with the "typing" capability.
+//
+// A client repeats Active=true every few seconds while the user keeps
+// typing; receivers drop an indicator that was not repeated in time
+// or when a chat message from that user arrives.
+type Typing struct {
+	Username string `json:"username,omitempty"`
+	Active   bool   `json:"active"`
+}
+
+// Direct is a private message to one member of the room
+//
+// Client → server: To and Body. Server → that member only: From, Key
+// and Time are filled in by the server. Only travels between peers
+// with the "direct" capability and is never stored in the history.
+//
+// Body is encrypted with a key that only the two members can derive
+// from their key pairs (the room key is not used), so neither the
+// server nor the rest of the room can read it. Key is the sender's
+// public key from their hello; the recipient needs it to decrypt.
+type Direct struct {
+	From string `json:"from,omitempty"`
+	To   string `json:"to"`
+	Body string `json:"body"`
+	Key  string `json:"key,omitempty"`
+	Time int64  `json:"time,omitempty"` // unix seconds when relayed
+}
+
+// Nick asks the server to change our username in the room
+//
+// Only sent when both sides have the "nick" capability. The new name
+// follows the same rules as in hello and must be free in the room.
+// On success everyone in the room, the sender included, gets a
+// "renamed" system event; otherwise the sender gets bad_username or
+// username_taken. The resume token moves to the new name.
+type Nick struct {
+	Username string `json:"username"`
+}
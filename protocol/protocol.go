@@ -0,0 +1,157 @@
+package protocol
+
+// ============================================================
+// WIRE PROTOCOL
+// Length-prefixed, versioned frames shared by server and client
+// ============================================================
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Version is the protocol version written into every frame header
+const Version uint8 = 1
+
+// HeaderSize is the fixed size of a frame header in bytes
+const HeaderSize = 6
+
+// MaxPayloadSize is the largest payload a frame may carry
+//
+// The length is known before the payload is read, so oversized
+// frames are rejected without allocating memory for them.
+const MaxPayloadSize = 64 * 1024
+
+// ErrFrameTooLarge is returned when a frame announces a payload
+// bigger than allowed for its type (see limits.go)
+var ErrFrameTooLarge = errors.New("frame too large")
+
+// Frame is one message on the wire
+//
+// Layout:
+//
+//	[version (1 byte)][type (1 byte)][length (4 bytes, big-endian)][payload]
+//
+// The payload is a JSON object whose shape depends on Type
+// (see messages.go).
+type Frame struct {
+	Version uint8
+	Type    Type
+	Payload []byte
+}
+
+// NewFrame builds a frame of the given type with v encoded as payload
+func NewFrame(t Type, v interface{}) (Frame, error) {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return Frame{}, err
+	}
+
+	return Frame{Version: Version, Type: t, Payload: payload}, nil
+}
+
+// Decode unpacks the frame payload into v
+func (f Frame) Decode(v interface{}) error {
+	if err := json.Unmarshal(f.Payload, v); err != nil {
+		return fmt.Errorf("invalid %s payload: %w", f.Type, err)
+	}
+	return nil
+}
+
+// WriteFrame writes a frame to w
+//
+// Header and payload go out in a single Write call, so transports
+// that are message-oriented (e.g. WebSocket) get exactly one frame
+// per message.
+func WriteFrame(w io.Writer, f Frame) error {
+	if len(f.Payload) > MaxPayloadSize {
+		return ErrFrameTooLarge
+	}
+
+	buf := make([]byte, HeaderSize+len(f.Payload))
+	buf[0] = f.Version
+	buf[1] = byte(f.Type)
+	binary.BigEndian.PutUint32(buf[2:HeaderSize], uint32(len(f.Payload)))
+	copy(buf[HeaderSize:], f.Payload)
+
+	_, err := w.Write(buf)
+	return err
+}
+
+// ReadFrame reads one frame from r
+//
+// Payloads over PayloadLimit for the frame's type are rejected
+// with a *FrameTooLargeError.
+func ReadFrame(r io.Reader) (Frame, error) {
+	return ReadFrameLimited(r, PayloadLimit)
+}
+
+// ReadFrameLimited reads one frame like ReadFrame, but with limit(t)
+// as the largest payload for type t
+//
+// The payload is never read (or allocated) when the header announces
+// more than that.
+func ReadFrameLimited(r io.Reader, limit func(Type) int) (Frame, error) {
+	var header [HeaderSize]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return Frame{}, err
+	}
+
+	t := Type(header[1])
+	length := binary.BigEndian.Uint32(header[2:])
+	max := limit(t)
+	if max > MaxPayloadSize {
+		max = MaxPayloadSize
+	}
+	if length > uint32(max) {
+		return Frame{}, &FrameTooLargeError{Type: t, Length: int(length), Limit: max}
+	}
+
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return Frame{}, err
+	}
+
+	return Frame{
+		Version: header[0],
+		Type:    t,
+		Payload: payload,
+	}, nil
+}
+
+// Send encodes v into a frame of type t and writes it to w
+func Send(w io.Writer, t Type, v interface{}) error {
+	f, err := NewFrame(t, v)
+	if err != nil {
+		return err
+	}
+	return WriteFrame(w, f)
+}
+
+// Expect reads the next frame and decodes it into v
+//
+// An error frame from the peer is returned as *Error, any other
+// unexpected type as a plain error.
+func Expect(r io.Reader, t Type, v interface{}) error {
+	f, err := ReadFrame(r)
+	if err != nil {
+		return err
+	}
+
+	if f.Type == TypeError && t != TypeError {
+		var e Error
+		if err := f.Decode(&e); err != nil {
+			return err
+		}
+		return &e
+	}
+
+	if f.Type != t {
+		return fmt.Errorf("unexpected %s frame (want %s)", f.Type, t)
+	}
+
+	return f.Decode(v)
+}
@@ -0,0 +1,197 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"testing"
+)
+
+// header builds a raw frame header announcing length payload bytes
+func header(version uint8, t Type, length uint32) []byte {
+	h := make([]byte, HeaderSize)
+	h[0] = version
+	h[1] = byte(t)
+	binary.BigEndian.PutUint32(h[2:], length)
+	return h
+}
+
+func TestWriteFrameLayout(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteFrame(&buf, Frame{Version: Version, Type: TypeChat, Payload: []byte(`{"body":"x"}`)}); err != nil {
+		t.Fatal(err)
+	}
+
+	want := append(header(Version, TypeChat, 12), `{"body":"x"}`...)
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Errorf("wrote % x, want % x", buf.Bytes(), want)
+	}
+}
+
+func TestFrameRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		t    Type
+		v    interface{}
+	}{
+		{"hello", TypeHello, Hello{Version: Version, Capabilities: []string{CapHistory}, Username: "alice"}},
+		{"chat", TypeChat, Chat{From: "bob", Body: "c2VjcmV0", Seq: 7}},
+		{"empty leave", TypeLeave, struct{}{}},
+		{"error", TypeError, Error{Code: ErrTooManyAttempts, Message: "wait", RetryAfter: 3}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := Send(&buf, tt.t, tt.v); err != nil {
+				t.Fatal(err)
+			}
+			sent := append([]byte(nil), buf.Bytes()[HeaderSize:]...)
+
+			f, err := ReadFrame(&buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if f.Version != Version || f.Type != tt.t {
+				t.Errorf("got v%d %s, want v%d %s", f.Version, f.Type, Version, tt.t)
+			}
+			if !bytes.Equal(f.Payload, sent) {
+				t.Errorf("payload %s, want %s", f.Payload, sent)
+			}
+			if buf.Len() != 0 {
+				t.Errorf("%d bytes left unread", buf.Len())
+			}
+		})
+	}
+}
+
+func TestFramesBackToBack(t *testing.T) {
+	var buf bytes.Buffer
+	for _, body := range []string{"one", "two", "three"} {
+		if err := Send(&buf, TypeChat, Chat{Body: body}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, want := range []string{"one", "two", "three"} {
+		var chat Chat
+		if err := Expect(&buf, TypeChat, &chat); err != nil {
+			t.Fatal(err)
+		}
+		if chat.Body != want {
+			t.Errorf("body %q, want %q", chat.Body, want)
+		}
+	}
+	if _, err := ReadFrame(&buf); err != io.EOF {
+		t.Errorf("after the last frame: %v, want io.EOF", err)
+	}
+}
+
+func TestWriteFrameTooLarge(t *testing.T) {
+	var buf bytes.Buffer
+	err := WriteFrame(&buf, Frame{Version: Version, Type: TypeChat, Payload: make([]byte, MaxPayloadSize+1)})
+	if !errors.Is(err, ErrFrameTooLarge) {
+		t.Errorf("got %v, want ErrFrameTooLarge", err)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("%d bytes written for a rejected frame", buf.Len())
+	}
+}
+
+// headerOnly fails the test if anything past the header is read
+type headerOnly struct {
+	t    *testing.T
+	data []byte
+}
+
+func (r *headerOnly) Read(p []byte) (int, error) {
+	if len(r.data) == 0 {
+		r.t.Fatal("payload of an oversized frame was read")
+	}
+	n := copy(p, r.data)
+	r.data = r.data[n:]
+	return n, nil
+}
+
+func TestReadFrameRejectsByHeader(t *testing.T) {
+	r := &headerOnly{t: t, data: header(Version, TypeChat, MaxPayloadSize+1)}
+
+	_, err := ReadFrame(r)
+	if !errors.Is(err, ErrFrameTooLarge) {
+		t.Fatalf("got %v, want ErrFrameTooLarge", err)
+	}
+}
+
+func TestReadFrameTruncated(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{"nothing", nil, io.EOF},
+		{"half a header", header(Version, TypeChat, 4)[:3], io.ErrUnexpectedEOF},
+		{"short payload", append(header(Version, TypeChat, 4), "ab"...), io.ErrUnexpectedEOF},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ReadFrame(bytes.NewReader(tt.data)); err != tt.want {
+				t.Errorf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestExpect(t *testing.T) {
+	t.Run("error frame", func(t *testing.T) {
+		var buf bytes.Buffer
+		Send(&buf, TypeError, Error{Code: ErrRoomNotFound, Message: "Room not found"})
+
+		var ack Ack
+		err := Expect(&buf, TypeAck, &ack)
+		var protoErr *Error
+		if !errors.As(err, &protoErr) || protoErr.Code != ErrRoomNotFound {
+			t.Errorf("got %v, want *Error %s", err, ErrRoomNotFound)
+		}
+	})
+
+	t.Run("unexpected type", func(t *testing.T) {
+		var buf bytes.Buffer
+		Send(&buf, TypeChat, Chat{Body: "x"})
+
+		var ack Ack
+		err := Expect(&buf, TypeAck, &ack)
+		var protoErr *Error
+		if err == nil || errors.As(err, &protoErr) {
+			t.Errorf("got %v, want a plain error", err)
+		}
+	})
+
+	t.Run("bad payload", func(t *testing.T) {
+		var buf bytes.Buffer
+		WriteFrame(&buf, Frame{Version: Version, Type: TypeAck, Payload: []byte("not json")})
+
+		var ack Ack
+		if err := Expect(&buf, TypeAck, &ack); err == nil {
+			t.Error("invalid JSON was accepted")
+		}
+	})
+}
+
+func TestTypeString(t *testing.T) {
+	tests := []struct {
+		t    Type
+		want string
+	}{
+		{TypeHello, "hello"},
+		{TypeLeave, "leave"},
+		{Type(200), "type(200)"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.t.String(); got != tt.want {
+			t.Errorf("Type(%d).String() = %q, want %q", uint8(tt.t), got, tt.want)
+		}
+	}
+}
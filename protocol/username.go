@@ -0,0 +1,63 @@
+package protocol
+
+// ============================================================
+// USERNAMES
+// The server enforces these rules; clients check them too, so a
+// typo is caught before anything is sent
+// ============================================================
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// MaxUsernameRunes is the longest username in characters (runes)
+const MaxUsernameRunes = 16
+
+// reservedUsernames can't be used by anyone: they would look like
+// messages from the server or the operator
+var reservedUsernames = map[string]bool{
+	"admin":    true,
+	"everyone": true,
+	"operator": true,
+	"owner":    true,
+	"root":     true,
+	"server":   true,
+	"system":   true,
+}
+
+// CheckUsername returns a bad_username *Error if name is not allowed
+//
+// A username is 1 to MaxUsernameRunes letters, digits, "_", "-" or
+// ".", starting with a letter or digit, and not a reserved word.
+func CheckUsername(name string) error {
+	bad := func(format string, args ...interface{}) error {
+		return &Error{Code: ErrBadUsername, Message: fmt.Sprintf(format, args...)}
+	}
+
+	if name == "" {
+		return bad("Username cannot be empty")
+	}
+	if !utf8.ValidString(name) {
+		return bad("Username is not valid UTF-8")
+	}
+	if n := utf8.RuneCountInString(name); n > MaxUsernameRunes {
+		return bad("Username is too long (%d characters, limit %d)", n, MaxUsernameRunes)
+	}
+
+	for i, r := range name {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+		case i > 0 && (r == '_' || r == '-' || r == '.'):
+		default:
+			return bad("Username may only contain letters, digits, \"_\", \"-\" and \".\", and must start with a letter or digit")
+		}
+	}
+
+	if reservedUsernames[strings.ToLower(name)] {
+		return bad("Username %q is reserved", name)
+	}
+	return nil
+}
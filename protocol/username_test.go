@@ -0,0 +1,68 @@
+package protocol
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestCheckUsername(t *testing.T) {
+	tests := []struct {
+		name string
+		ok   bool
+	}{
+		{"alice", true},
+		{"Alice_42", true},
+		{"a", true},
+		{"7up", true},
+		{"bob.smith", true},
+		{"mary-jane", true},
+		{"Жора", true},
+		{"李小龙", true},
+		{strings.Repeat("a", MaxUsernameRunes), true},
+		{strings.Repeat("ж", MaxUsernameRunes), true}, // 32 bytes, 16 characters
+
+		{"", false},
+		{strings.Repeat("a", MaxUsernameRunes+1), false},
+		{strings.Repeat("ж", MaxUsernameRunes+1), false},
+		{"_alice", false},
+		{"-alice", false},
+		{".alice", false},
+		{"al ice", false},
+		{"alice!", false},
+		{"al\u200bice", false}, // zero-width space
+		{"al\nice", false},
+		{"\xff\xfe", false},
+		{"admin", false},
+		{"Server", false},
+		{"SYSTEM", false},
+		{"root", false},
+		{"admin2", true},
+	}
+
+	for _, tt := range tests {
+		err := CheckUsername(tt.name)
+		if tt.ok {
+			if err != nil {
+				t.Errorf("CheckUsername(%q) = %v, want ok", tt.name, err)
+			}
+			continue
+		}
+
+		var protoErr *Error
+		if !errors.As(err, &protoErr) || protoErr.Code != ErrBadUsername {
+			t.Errorf("CheckUsername(%q) = %v, want %s", tt.name, err, ErrBadUsername)
+		}
+	}
+}
+
+func TestUsernameFitsByteLimit(t *testing.T) {
+	// The longest allowed name (4-byte characters) still fits the field limit
+	name := strings.Repeat("𝔞", MaxUsernameRunes)
+	if err := CheckUsername(name); err != nil {
+		t.Fatalf("CheckUsername(%q) = %v", name, err)
+	}
+	if err := (Hello{Username: name}).CheckLimits(); err != nil {
+		t.Errorf("Hello.CheckLimits with a %d-byte name: %v", len(name), err)
+	}
+}
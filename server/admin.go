@@ -0,0 +1,293 @@
+package main
+
+// ============================================================
+// АДМИНКА: УПРАВЛЯЮЩИЙ UNIX-СОКЕТ
+// ============================================================
+//
+// Сервер слушает локальный Unix-сокет (флаг -admin-socket).
+// Права 0600 — подключиться может только тот, кто запустил сервер.
+// Сокет создаётся в закрытом каталоге (0700) и появляется по пути
+// -admin-socket уже с правами 0600, так что окна между Listen и
+// Chmod, когда к нему мог бы подключиться кто угодно, нет.
+//
+// Протокол: одна JSON-строка запроса → одна JSON-строка ответа.
+//
+//	{"command":"rooms"}
+//	{"command":"clients","room":"12345678"}       (room пустой — все комнаты)
+//	{"command":"kick","room":"12345678","username":"bob"}
+//	{"command":"close","room":"12345678"}
+//	{"command":"notice","text":"Restart at 18:00"} (room пустой — всем)
+//
+// Команды из терминала — см. admin_cli.go ("go run . admin ...").
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"messenger-protocol"
+)
+
+// adminRequest — запрос к админке
+type adminRequest struct {
+	Command  string `json:"command"`
+	Room     string `json:"room,omitempty"`
+	Username string `json:"username,omitempty"`
+	Text     string `json:"text,omitempty"`
+}
+
+// adminResponse — ответ админки
+type adminResponse struct {
+	OK       bool          `json:"ok"`
+	Error    string        `json:"error,omitempty"`
+	Rooms    []adminRoom   `json:"rooms,omitempty"`
+	Clients  []adminClient `json:"clients,omitempty"`
+	Affected int           `json:"affected,omitempty"` // сколько клиентов затронуто
+}
+
+type adminRoom struct {
+	Code       string    `json:"code"`
+	Owner      string    `json:"owner"`
+	Clients    int       `json:"clients"`
+	CreatedAt  time.Time `json:"created_at"`
+	AgeSeconds int64     `json:"age_seconds"`
+	Persistent bool      `json:"persistent"`
+}
+
+type adminClient struct {
+	Room       string    `json:"room"`
+	Username   string    `json:"username"`
+	RemoteAddr string    `json:"remote_addr"`
+	JoinedAt   time.Time `json:"joined_at"`
+}
+
+// serveAdmin слушает Unix-сокет и выполняет команды
+func serveAdmin(path string) error {
+	listener, err := listenAdmin(path)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(path)
+	defer listener.Close()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+		go handleAdmin(conn)
+	}
+}
+
+// listenAdmin создаёт сокет админки по пути path
+//
+// Сокет создаётся во временном каталоге с правами 0700 рядом с path,
+// получает права 0600 и только потом переносится на место (заменяя
+// старый сокет от прошлого запуска). Удалять его при остановке должен
+// вызывающий: listener помнит только временное имя.
+func listenAdmin(path string) (net.Listener, error) {
+	dir, err := os.MkdirTemp(filepath.Dir(path), ".admin-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	tmp := filepath.Join(dir, "sock")
+	listener, err := net.Listen("unix", tmp)
+	if err != nil {
+		return nil, err
+	}
+	listener.(*net.UnixListener).SetUnlinkOnClose(false)
+
+	if err := os.Chmod(tmp, 0600); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	return listener, nil
+}
+
+// handleAdmin обрабатывает одно подключение к админке
+func handleAdmin(conn net.Conn) {
+	defer conn.Close()
+
+	reader := bufio.NewReader(conn)
+	encoder := json.NewEncoder(conn)
+
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			return
+		}
+
+		var req adminRequest
+		if err := json.Unmarshal(line, &req); err != nil {
+			encoder.Encode(adminResponse{Error: "invalid request: " + err.Error()})
+			continue
+		}
+
+		encoder.Encode(runAdminCommand(req))
+	}
+}
+
+// runAdminCommand выполняет одну команду
+func runAdminCommand(req adminRequest) adminResponse {
+	switch req.Command {
+	case "rooms":
+		return adminResponse{OK: true, Rooms: adminListRooms()}
+
+	case "clients":
+		rooms, err := adminSelectRooms(req.Room)
+		if err != nil {
+			return adminResponse{Error: err.Error()}
+		}
+		return adminResponse{OK: true, Clients: adminListClients(rooms)}
+
+	case "kick":
+		return adminKick(req.Room, req.Username)
+
+	case "close":
+		return adminClose(req.Room)
+
+	case "notice":
+		return adminNotice(req.Room, req.Text)
+	}
+
+	return adminResponse{Error: fmt.Sprintf("unknown command %q", req.Command)}
+}
+
+// adminSelectRooms — одна комната по коду или все, если код пустой
+func adminSelectRooms(code string) ([]*Room, error) {
+	if code == "" {
+		return store.List(), nil
+	}
+
+	room := GetRoom(code)
+	if room == nil {
+		return nil, errors.New("room not found")
+	}
+	return []*Room{room}, nil
+}
+
+func adminListRooms() []adminRoom {
+	now := time.Now()
+	list := make([]adminRoom, 0)
+
+	for _, room := range store.List() {
+		list = append(list, adminRoom{
+			Code:       room.Code,
+			Owner:      room.OwnerName(),
+			Clients:    room.GetClientCount(),
+			CreatedAt:  room.CreatedAt,
+			AgeSeconds: int64(now.Sub(room.CreatedAt).Seconds()),
+			Persistent: room.Settings.Persistent,
+		})
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].CreatedAt.Before(list[j].CreatedAt)
+	})
+	return list
+}
+
+func adminListClients(rooms []*Room) []adminClient {
+	list := make([]adminClient, 0)
+
+	for _, room := range rooms {
+		for _, client := range room.ClientList() {
+			list = append(list, adminClient{
+				Room:       room.Code,
+				Username:   client.Name(),
+				RemoteAddr: client.Conn.RemoteAddr().String(),
+				JoinedAt:   client.JoinedAt,
+			})
+		}
+	}
+	return list
+}
+
+// adminKick отключает клиента (всех клиентов с этим именем в комнате)
+// Имя сравнивается без учёта регистра, как в username.go.
+//
+// Достаточно закрыть соединение: handleClient увидит ошибку чтения
+// и сам уберёт клиента из комнаты и разошлёт "left".
+func adminKick(code, username string) adminResponse {
+	room := GetRoom(code)
+	if room == nil {
+		return adminResponse{Error: "room not found"}
+	}
+
+	kicked := 0
+	for _, client := range room.ClientList() {
+		name := client.Name()
+		if !strings.EqualFold(name, username) {
+			continue
+		}
+		room.revokeResume(name)
+		client.Send(systemFrame(protocol.EventKicked, name, "You were removed from the room by the server operator"))
+		client.Close()
+		kicked++
+	}
+
+	if kicked == 0 {
+		return adminResponse{Error: "no such user in the room"}
+	}
+
+	logger.Info("admin_kick", "room", code, "user", username, "clients", kicked)
+	return adminResponse{OK: true, Affected: kicked}
+}
+
+// adminClose закрывает комнату: удаляет её (даже постоянную)
+// и отключает всех, кто в ней был
+func adminClose(code string) adminResponse {
+	room := GetRoom(code)
+	if room == nil {
+		return adminResponse{Error: "room not found"}
+	}
+
+	// Сначала удаляем, чтобы никто не успел зайти заново
+	if err := DeleteRoom(code); err != nil {
+		return adminResponse{Error: err.Error()}
+	}
+
+	clients := room.ClientList()
+	notice := systemFrame(protocol.EventClosed, "", "The room was closed by the server operator")
+	for _, client := range clients {
+		client.Send(notice)
+		client.Close()
+	}
+
+	logger.Info("admin_close", "room", code, "clients", len(clients))
+	return adminResponse{OK: true, Affected: len(clients)}
+}
+
+// adminNotice рассылает сообщение оператора
+func adminNotice(code, text string) adminResponse {
+	if text == "" {
+		return adminResponse{Error: "notice text is empty"}
+	}
+
+	rooms, err := adminSelectRooms(code)
+	if err != nil {
+		return adminResponse{Error: err.Error()}
+	}
+
+	notice := systemFrame(protocol.EventNotice, "", "[server] "+text)
+	sent := 0
+	for _, room := range rooms {
+		sent += room.GetClientCount()
+		room.Broadcast(notice, nil)
+	}
+
+	return adminResponse{OK: true, Affected: sent}
+}
@@ -0,0 +1,146 @@
+package main
+
+// ============================================================
+// АДМИНКА: КОМАНДЫ ИЗ ТЕРМИНАЛА
+// ============================================================
+//
+//	go run . admin rooms
+//	go run . admin clients [CODE]
+//	go run . admin kick CODE USERNAME
+//	go run . admin close CODE
+//	go run . admin notice [-room CODE] TEXT...
+//
+// Подключается к Unix-сокету запущенного сервера (см. admin.go).
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// defaultAdminSocket — путь к сокету по умолчанию
+const defaultAdminSocket = "messenger-admin.sock"
+
+// runAdminCLI выполняет команду админки и возвращает код выхода
+func runAdminCLI(args []string) int {
+	flags := flag.NewFlagSet("admin", flag.ContinueOnError)
+	socket := flags.String("socket", defaultAdminSocket, "Admin socket of the running server")
+	room := flags.String("room", "", "Room code for notice (all rooms if empty)")
+	flags.Usage = func() {
+		fmt.Println("Usage: go run . admin [-socket PATH] COMMAND")
+		fmt.Println("")
+		fmt.Println("Commands:")
+		fmt.Println("  rooms                      List rooms with client counts and ages")
+		fmt.Println("  clients [CODE]             List connected clients (all rooms if no code)")
+		fmt.Println("  kick CODE USERNAME         Disconnect a client")
+		fmt.Println("  close CODE                 Close a room and disconnect everyone in it")
+		fmt.Println("  notice [-room CODE] TEXT   Send a server notice")
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	rest := flags.Args()
+	if len(rest) == 0 {
+		flags.Usage()
+		return 2
+	}
+
+	// Флаги после имени команды: "notice -room 123 text"
+	if err := flags.Parse(rest[1:]); err != nil {
+		return 2
+	}
+	req := adminRequest{Command: rest[0]}
+	params := flags.Args()
+
+	switch req.Command {
+	case "rooms":
+	case "clients":
+		if len(params) > 0 {
+			req.Room = params[0]
+		}
+	case "kick":
+		if len(params) != 2 {
+			flags.Usage()
+			return 2
+		}
+		req.Room, req.Username = params[0], params[1]
+	case "close":
+		if len(params) != 1 {
+			flags.Usage()
+			return 2
+		}
+		req.Room = params[0]
+	case "notice":
+		req.Room = *room
+		req.Text = strings.Join(params, " ")
+	default:
+		flags.Usage()
+		return 2
+	}
+
+	resp, err := adminCall(*socket, req)
+	if err != nil {
+		fmt.Println("Error:", err)
+		return 1
+	}
+	if !resp.OK {
+		fmt.Println("Error:", resp.Error)
+		return 1
+	}
+
+	printAdminResponse(req.Command, resp)
+	return 0
+}
+
+// adminCall отправляет запрос в сокет и читает ответ
+func adminCall(socket string, req adminRequest) (adminResponse, error) {
+	var resp adminResponse
+
+	conn, err := net.DialTimeout("unix", socket, 2*time.Second)
+	if err != nil {
+		return resp, fmt.Errorf("cannot reach server admin socket %s: %w", socket, err)
+	}
+	defer conn.Close()
+
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		return resp, err
+	}
+
+	line, err := bufio.NewReader(conn).ReadBytes('\n')
+	if err != nil {
+		return resp, err
+	}
+	err = json.Unmarshal(line, &resp)
+	return resp, err
+}
+
+func printAdminResponse(command string, resp adminResponse) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	defer w.Flush()
+
+	switch command {
+	case "rooms":
+		fmt.Fprintln(w, "CODE\tOWNER\tCLIENTS\tAGE\tPERSISTENT")
+		for _, r := range resp.Rooms {
+			age := (time.Duration(r.AgeSeconds) * time.Second).String()
+			fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%v\n", r.Code, r.Owner, r.Clients, age, r.Persistent)
+		}
+
+	case "clients":
+		fmt.Fprintln(w, "ROOM\tUSERNAME\tREMOTE ADDRESS\tCONNECTED")
+		for _, c := range resp.Clients {
+			since := time.Since(c.JoinedAt).Round(time.Second)
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", c.Room, c.Username, c.RemoteAddr, since)
+		}
+
+	default:
+		fmt.Fprintf(w, "OK (%d client(s) affected)\n", resp.Affected)
+	}
+}
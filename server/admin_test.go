@@ -0,0 +1,39 @@
+package main
+
+import "testing"
+
+func TestAdminKick(t *testing.T) {
+	quietLogger(t)
+	withStore(t, NewMemoryStore())
+
+	room := NewRoom("12345678", "alice", RoomSettings{})
+	bob := readingClient(t, "Bob")
+	alice := readingClient(t, "alice")
+	room.Clients = append(room.Clients, bob, alice)
+	if err := store.Create(room); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		code, username string
+		ok             bool
+	}{
+		{"12345678", "carol", false},
+		{"87654321", "bob", false},
+		{"12345678", "bob", true}, // имена уникальны без учёта регистра
+	}
+
+	for _, tt := range tests {
+		resp := adminKick(tt.code, tt.username)
+		if resp.OK != tt.ok {
+			t.Errorf("kick %s %s: %+v, want ok=%v", tt.code, tt.username, resp, tt.ok)
+		}
+	}
+
+	if !bob.isClosing() {
+		t.Error("Bob is still connected")
+	}
+	if alice.isClosing() {
+		t.Error("alice was kicked too")
+	}
+}
@@ -1,142 +1,300 @@
 package main
 
 // ============================================================
-// ЭТОТ КОД — КОПИЯ random.go (твоя логика!)
-// Изменения только в GenerateRoomCode() в конце файла
+// ГЕНЕРАЦИЯ КОДОВ КОМНАТ
 // ============================================================
+//
+// Код комнаты — единственное, что нужно знать, чтобы постучаться
+// в комнату, поэтому он должен быть непредсказуемым.
+// Все генераторы используют crypto/rand.
+//
+// Форматы (флаг -code-format):
+//   numeric — N цифр:                      "04819273"
+//   base32  — группы по 4 символа Crockford: "K7QF-M2XA"
+//   words   — слова из списка:              "amber-otter-seven-kiwi"
 
 import (
+	"crypto/rand"
 	"fmt"
-	"math/rand"
-	"time"
+	"math/big"
+	"strings"
 )
 
-// init вызывается автоматически при старте программы
-func init() {
-	rand.Seed(time.Now().UnixNano())
+// CodeGenerator создаёт и проверяет коды комнат одного формата
+type CodeGenerator interface {
+	// Generate создаёт новый случайный код
+	Generate() (string, error)
+
+	// Normalize приводит введённый код к каноническому виду
+	// (регистр, лишние пробелы)
+	Normalize(code string) string
+
+	// Valid проверяет что код подходит под формат
+	Valid(code string) bool
+
+	// Describe — подсказка для клиента, например "8 digits"
+	Describe() string
 }
 
-// Глобальные переменные для часовых поясов
-var (
-	helsinkiLoc = mustLoadLocation("Europe/Helsinki")
-	naplesLoc   = mustLoadLocation("Europe/Rome")
-	londonLoc   = mustLoadLocation("Europe/London")
-	sfLoc       = mustLoadLocation("America/Los_Angeles")
-)
+// codeGen — генератор, который выбран при запуске сервера
+var codeGen CodeGenerator = numericCodes{length: 8}
 
-func mustLoadLocation(name string) *time.Location {
-	loc, err := time.LoadLocation(name)
-	if err != nil {
-		return time.UTC
+// NewCodeGenerator создаёт генератор по названию формата
+// length = 0 — длина по умолчанию для формата
+func NewCodeGenerator(format string, length int) (CodeGenerator, error) {
+	if length < 0 {
+		return nil, fmt.Errorf("code length must be positive")
 	}
-	return loc
+
+	switch format {
+	case "numeric":
+		if length == 0 {
+			length = 8
+		}
+		if length < 6 || length > 32 {
+			return nil, fmt.Errorf("numeric codes must have 6-32 digits")
+		}
+		return numericCodes{length: length}, nil
+
+	case "base32":
+		if length == 0 {
+			length = 8
+		}
+		if length < 6 || length > 32 {
+			return nil, fmt.Errorf("base32 codes must have 6-32 characters")
+		}
+		return base32Codes{length: length}, nil
+
+	case "words":
+		if length == 0 {
+			length = 4
+		}
+		if length < 3 || length > 12 {
+			return nil, fmt.Errorf("word codes must have 3-12 words")
+		}
+		return wordCodes{count: length}, nil
+	}
+
+	return nil, fmt.Errorf("unknown code format %q (use numeric, base32 or words)", format)
+}
+
+// GenerateRoomCode создаёт код в формате сервера
+func GenerateRoomCode() (string, error) {
+	return codeGen.Generate()
+}
+
+// NormalizeCode приводит введённый код к формату сервера
+func NormalizeCode(code string) string {
+	return codeGen.Normalize(code)
+}
+
+// IsValidCode проверяет формат кода
+func IsValidCode(code string) bool {
+	return codeGen.Valid(code)
 }
 
-// тут начинаем собирать data
-func getHelsinkiHour() byte {
-	loc, err := time.LoadLocation("Europe/Helsinki")
+// randomIndex — случайное число 0..n-1 из crypto/rand (равномерно)
+func randomIndex(n int) (int, error) {
+	v, err := rand.Int(rand.Reader, big.NewInt(int64(n)))
 	if err != nil {
-		loc = time.UTC
+		return 0, err
 	}
-	return byte(time.Now().In(loc).Hour())
+	return int(v.Int64()), nil
 }
 
-func getNaplesHour() byte {
-	loc, err := time.LoadLocation("Europe/Rome")
-	if err != nil {
-		loc = time.UTC
+// randomString собирает строку из length случайных символов alphabet
+func randomString(alphabet string, length int) (string, error) {
+	var b strings.Builder
+	for i := 0; i < length; i++ {
+		idx, err := randomIndex(len(alphabet))
+		if err != nil {
+			return "", err
+		}
+		b.WriteByte(alphabet[idx])
 	}
-	return byte(time.Now().In(loc).Hour())
+	return b.String(), nil
 }
 
-func getLondonHour() byte {
-	loc, err := time.LoadLocation("Europe/London")
-	if err != nil {
-		loc = time.UTC
+// ============================================================
+// numeric — только цифры
+// ============================================================
+
+type numericCodes struct {
+	length int
+}
+
+func (g numericCodes) Generate() (string, error) {
+	return randomString("0123456789", g.length)
+}
+
+func (g numericCodes) Normalize(code string) string {
+	return strings.TrimSpace(code)
+}
+
+func (g numericCodes) Valid(code string) bool {
+	// Проверяем длину
+	if len(code) != g.length {
+		return false
+	}
+
+	// Проверяем что все символы — цифры
+	for _, char := range code {
+		if char < '0' || char > '9' {
+			return false
+		}
 	}
-	return byte(time.Now().In(loc).Hour())
+	return true
 }
 
-func getSanFranciscoUnixMinutes() byte {
-	loc, err := time.LoadLocation("America/Los_Angeles")
+func (g numericCodes) Describe() string {
+	return fmt.Sprintf("%d digits", g.length)
+}
+
+// ============================================================
+// base32 — Crockford Base32, группы по 4 символа
+// ============================================================
+
+// Без I, L, O, U — их легко спутать с 1, 0 и V
+const crockfordAlphabet = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+type base32Codes struct {
+	length int // символов без дефисов
+}
+
+func (g base32Codes) Generate() (string, error) {
+	raw, err := randomString(crockfordAlphabet, g.length)
 	if err != nil {
-		loc = time.UTC
+		return "", err
 	}
-	unixMinutes := time.Now().In(loc).Unix() / 60
-	return byte(unixMinutes) // Берём только последний байт
-}
 
-func getNanoseconds() byte {
-	return byte(time.Now().Nanosecond())
+	// "K7QFM2XA" → "K7QF-M2XA"
+	groups := make([]string, 0, (g.length+3)/4)
+	for i := 0; i < len(raw); i += 4 {
+		end := i + 4
+		if end > len(raw) {
+			end = len(raw)
+		}
+		groups = append(groups, raw[i:end])
+	}
+	return strings.Join(groups, "-"), nil
 }
 
-func Data() byte {
-	neapol := getNaplesHour()
-	london := getLondonHour()
-	helsinki := getHelsinkiHour()
-	nano := getNanoseconds()
-	san_francisco := getSanFranciscoUnixMinutes()
-	key := neapol ^ london ^ helsinki ^ san_francisco ^ nano
-	return key
+// Похожие символы исправляем так же, как предлагает Crockford
+var crockfordFixes = strings.NewReplacer("I", "1", "L", "1", "O", "0")
+
+func (g base32Codes) Normalize(code string) string {
+	return crockfordFixes.Replace(strings.ToUpper(strings.TrimSpace(code)))
 }
 
-func Key() byte {
-	number := rand.Intn(100) + 10
-	var result_key int
-	for i := 0; i < number; i++ {
-		num1 := rand.Intn(10000)
-		num2 := rand.Intn(10000)
-		result_key += num1 ^ num2
+func (g base32Codes) Valid(code string) bool {
+	count := 0
+	for i, char := range code {
+		// Дефис стоит после каждых 4 символов
+		if (i+1)%5 == 0 {
+			if char != '-' {
+				return false
+			}
+			continue
+		}
+		if !strings.ContainsRune(crockfordAlphabet, char) {
+			return false
+		}
+		count++
 	}
-	return byte(result_key)
+	return count == g.length && !strings.HasSuffix(code, "-")
+}
+
+func (g base32Codes) Describe() string {
+	return fmt.Sprintf("%d characters like K7QF-M2XA", g.length)
 }
 
 // ============================================================
-// ГЕНЕРАЦИЯ 8-ЗНАЧНОГО КОДА КОМНАТЫ
-// Использует ТВОИ функции Data() и Key()
+// words — слова через дефис
 // ============================================================
 
-// GenerateRoomCode создаёт 8-значный код комнаты
-//
-// Как работает:
-//  1. Вызываем Data() ^ Key() — получаем 1 байт (0-255)
-//  2. Делаем это 3 раза — получаем 3 байта
-//  3. Объединяем: byte1 * 65536 + byte2 * 256 + byte3
-//     (это как записать число в 256-ричной системе)
-//  4. Берём остаток от 100000000 (чтобы было 8 цифр)
-//  5. Форматируем с ведущими нулями
-func GenerateRoomCode() string {
-	// Вызываем твои функции 3 раза
-	byte1 := Data() ^ Key()
-	byte2 := Data() ^ Key()
-	byte3 := Data() ^ Key()
-
-	// Объединяем в одно число
-	// byte1 = 0-255, byte2 = 0-255, byte3 = 0-255
-	// combined = 0 до 16,777,215 (256 * 256 * 256 - 1)
-	combined := int(byte1)*65536 + int(byte2)*256 + int(byte3)
-
-	// Берём остаток от 100,000,000 чтобы получить 8-значное число
-	code := combined % 100000000
-
-	// Форматируем: 42 → "00000042"
-	// %08d = 8 цифр, с ведущими нулями
-	return fmt.Sprintf("%08d", code)
+type wordCodes struct {
+	count int
 }
 
-// IsValidCode проверяет формат кода
-func IsValidCode(code string) bool {
-	// Проверяем длину — должно быть ровно 8 символов
-	if len(code) != 8 {
-		return false
+func (g wordCodes) Generate() (string, error) {
+	words := make([]string, g.count)
+	for i := range words {
+		idx, err := randomIndex(len(codeWords))
+		if err != nil {
+			return "", err
+		}
+		words[i] = codeWords[idx]
 	}
+	return strings.Join(words, "-"), nil
+}
 
-	// Проверяем что все символы — цифры
-	for _, char := range code {
-		if char < '0' || char > '9' {
+func (g wordCodes) Normalize(code string) string {
+	// Разрешаем пробелы вместо дефисов: "amber otter seven kiwi"
+	return strings.Join(strings.Fields(strings.ToLower(strings.ReplaceAll(code, "-", " "))), "-")
+}
+
+func (g wordCodes) Valid(code string) bool {
+	words := strings.Split(code, "-")
+	if len(words) != g.count {
+		return false
+	}
+	for _, w := range words {
+		if !codeWordSet[w] {
 			return false
 		}
 	}
-
 	return true
 }
+
+func (g wordCodes) Describe() string {
+	return fmt.Sprintf("%d words like amber-otter-seven-kiwi", g.count)
+}
+
+// codeWords — 256 коротких слов (8 бит на слово)
+var codeWords = []string{
+	"acid", "acorn", "alpine", "amber", "anchor", "apple", "arrow",
+	"aspen", "atlas", "autumn", "badge", "bagel", "bamboo", "banjo",
+	"barley", "basil", "bay", "beacon", "bear", "beaver", "berry", "birch",
+	"bison", "blaze", "bloom", "bobcat", "bolt", "bonsai", "breeze",
+	"brick", "brook", "bubble", "cabin", "cactus", "camel", "candle",
+	"canyon", "carbon", "cargo", "carrot", "castle", "cedar", "cello",
+	"chalk", "cherry", "chess", "cider", "cinder", "citrus", "cloud",
+	"clover", "coast", "cobalt", "cobra", "comet", "copper", "coral",
+	"cotton", "crane", "crater", "cricket", "crystal", "daisy", "dawn",
+	"delta", "denim", "desert", "diesel", "dingo", "dolphin", "domino",
+	"dragon", "drift", "dune", "dusk", "eagle", "echo", "eclipse", "ember",
+	"emerald", "engine", "falcon", "fern", "ferry", "fiddle", "field",
+	"fjord", "flame", "flint", "forest", "fossil", "fox", "frost",
+	"galaxy", "garnet", "gecko", "geyser", "ginger", "glacier", "glade",
+	"goblet", "granite", "grape", "gravel", "grove", "harbor", "hazel",
+	"heron", "hickory", "hill", "honey", "horizon", "husky", "iceberg",
+	"igloo", "indigo", "iris", "island", "ivory", "jade", "jaguar",
+	"jasmine", "jelly", "jigsaw", "juniper", "kayak", "kettle", "kiwi",
+	"koala", "lagoon", "lake", "lantern", "lark", "lava", "lemon", "lilac",
+	"lime", "linen", "lizard", "llama", "lobster", "lotus", "lunar",
+	"magnet", "mango", "maple", "marble", "marsh", "meadow", "melon",
+	"mesa", "meteor", "mint", "mirror", "mocha", "monsoon", "moose",
+	"mosaic", "moss", "nectar", "needle", "nickel", "nimbus", "noodle",
+	"nutmeg", "oak", "oasis", "ocean", "olive", "onyx", "orbit", "orchid",
+	"osprey", "otter", "owl", "oyster", "paddle", "panda", "papaya",
+	"parrot", "peach", "peak", "pebble", "pepper", "piano", "pine",
+	"pixel", "plasma", "plum", "polar", "pond", "poppy", "prairie",
+	"prism", "puffin", "pumpkin", "quartz", "quill", "quokka", "rabbit",
+	"radar", "rain", "raven", "reef", "ribbon", "ridge", "river", "robin",
+	"rocket", "ruby", "saddle", "saffron", "salmon", "sapphire", "satin",
+	"scarlet", "seven", "shadow", "sierra", "silver", "sketch", "sparrow",
+	"spruce", "squid", "stone", "storm", "summit", "sunset", "swan",
+	"tango", "thistle", "thunder", "tiger", "timber", "topaz", "tulip",
+	"tundra", "turtle", "twig", "umber", "valley", "vapor", "velvet",
+	"violet", "volcano", "walnut", "walrus", "wave", "willow", "wind",
+	"wolf", "yarrow", "yeti", "zebra", "zenith", "zephyr",
+}
+
+// codeWordSet — для быстрой проверки в Valid
+var codeWordSet = func() map[string]bool {
+	set := make(map[string]bool, len(codeWords))
+	for _, w := range codeWords {
+		set[w] = true
+	}
+	return set
+}()
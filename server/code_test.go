@@ -0,0 +1,139 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNewCodeGenerator(t *testing.T) {
+	tests := []struct {
+		format   string
+		length   int
+		ok       bool
+		describe string
+	}{
+		{"numeric", 0, true, "8 digits"},
+		{"numeric", 6, true, "6 digits"},
+		{"numeric", 32, true, "32 digits"},
+		{"numeric", 5, false, ""},
+		{"numeric", 33, false, ""},
+		{"base32", 0, true, "8 characters like K7QF-M2XA"},
+		{"base32", 10, true, "10 characters like K7QF-M2XA"},
+		{"base32", 4, false, ""},
+		{"words", 0, true, "4 words like amber-otter-seven-kiwi"},
+		{"words", 3, true, "3 words like amber-otter-seven-kiwi"},
+		{"words", 2, false, ""},
+		{"words", 13, false, ""},
+		{"numeric", -1, false, ""},
+		{"emoji", 0, false, ""},
+	}
+
+	for _, tt := range tests {
+		gen, err := NewCodeGenerator(tt.format, tt.length)
+		if (err == nil) != tt.ok {
+			t.Errorf("NewCodeGenerator(%q, %d) error = %v, want ok = %v", tt.format, tt.length, err, tt.ok)
+			continue
+		}
+		if tt.ok && gen.Describe() != tt.describe {
+			t.Errorf("NewCodeGenerator(%q, %d).Describe() = %q, want %q", tt.format, tt.length, gen.Describe(), tt.describe)
+		}
+	}
+}
+
+func TestGeneratedCodesAreValid(t *testing.T) {
+	tests := []struct {
+		format string
+		length int
+	}{
+		{"numeric", 8},
+		{"numeric", 6},
+		{"base32", 8},
+		{"base32", 10}, // последняя группа неполная
+		{"words", 4},
+	}
+
+	for _, tt := range tests {
+		gen, err := NewCodeGenerator(tt.format, tt.length)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		seen := make(map[string]bool)
+		for i := 0; i < 200; i++ {
+			code, err := gen.Generate()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !gen.Valid(code) {
+				t.Fatalf("%s/%d: generated code %q is not valid", tt.format, tt.length, code)
+			}
+			if gen.Normalize(code) != code {
+				t.Fatalf("%s/%d: generated code %q is not normalized", tt.format, tt.length, code)
+			}
+			seen[code] = true
+		}
+
+		// Коды случайные: 200 подряд почти наверняка разные
+		if len(seen) < 190 {
+			t.Errorf("%s/%d: only %d distinct codes out of 200", tt.format, tt.length, len(seen))
+		}
+	}
+}
+
+func TestCodeNormalizeAndValid(t *testing.T) {
+	numeric := numericCodes{length: 8}
+	base32 := base32Codes{length: 8}
+	base32Long := base32Codes{length: 10}
+	words := wordCodes{count: 4}
+
+	tests := []struct {
+		name  string
+		gen   CodeGenerator
+		input string
+		want  string // после Normalize
+		valid bool
+	}{
+		{"numeric", numeric, "04819273", "04819273", true},
+		{"numeric with spaces", numeric, "  04819273\n", "04819273", true},
+		{"numeric too short", numeric, "0481927", "0481927", false},
+		{"numeric with a letter", numeric, "0481927a", "0481927a", false},
+
+		{"base32", base32, "K7QF-M2XA", "K7QF-M2XA", true},
+		{"base32 lower case", base32, "k7qf-m2xa", "K7QF-M2XA", true},
+		{"base32 look-alikes", base32, "k7qf-m2xo", "K7QF-M2X0", true},
+		{"base32 I and L", base32, "ilqf-m2xa", "11QF-M2XA", true},
+		{"base32 without dash", base32, "K7QFM2XA", "K7QFM2XA", false},
+		{"base32 with U", base32, "K7QF-M2XU", "K7QF-M2XU", false},
+		{"base32 short group", base32Long, "K7QF-M2XA-B3", "K7QF-M2XA-B3", true},
+		{"base32 trailing dash", base32, "K7QF-M2XA-", "K7QF-M2XA-", false},
+
+		{"words", words, "amber-otter-seven-kiwi", "amber-otter-seven-kiwi", true},
+		{"words with spaces", words, " Amber otter  SEVEN-kiwi ", "amber-otter-seven-kiwi", true},
+		{"words unknown word", words, "amber-otter-seven-banana", "amber-otter-seven-banana", false},
+		{"words too few", words, "amber-otter-seven", "amber-otter-seven", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.gen.Normalize(tt.input)
+			if got != tt.want {
+				t.Errorf("Normalize(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+			if valid := tt.gen.Valid(got); valid != tt.valid {
+				t.Errorf("Valid(%q) = %v, want %v", got, valid, tt.valid)
+			}
+		})
+	}
+}
+
+func TestCodeWords(t *testing.T) {
+	// 256 разных слов — ровно 8 бит на слово
+	if len(codeWordSet) != 256 || len(codeWords) != 256 {
+		t.Errorf("%d words, %d distinct; want 256", len(codeWords), len(codeWordSet))
+	}
+	for _, w := range codeWords {
+		if w != strings.ToLower(w) || strings.ContainsAny(w, "- ") {
+			t.Errorf("word %q would not survive Normalize", w)
+		}
+	}
+}
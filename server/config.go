@@ -0,0 +1,316 @@
+package main
+
+// ============================================================
+// НАСТРОЙКИ СЕРВЕРА
+// ============================================================
+//
+// Каждую настройку можно задать тремя способами (по возрастанию приоритета):
+//
+//   1. файл конфигурации (-config или MESSENGER_CONFIG), JSON:
+//        {"listen": ":9000", "max-rooms": 100, "log-format": "json"}
+//   2. переменная окружения: MESSENGER_ + имя флага большими буквами,
+//      "-" заменяется на "_":  MESSENGER_MAX_ROOMS=100
+//   3. флаг командной строки:  -max-rooms=100
+//
+// Адрес -listen один: сервер слушает TCP только на нём (":9000" — на всех
+// интерфейсах). WebSocket — отдельный адрес -ws.
+//
+// Ключи файла и переменные — те же имена, что у флагов, поэтому
+// список настроек один: флаги в loadConfig.
+// -dump-config печатает итоговые настройки (в формате файла) и выходит.
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"messenger-protocol"
+)
+
+// serverConfig — настройки, которые main раздаёт по серверу.
+// Лимиты и размеры буферов живут в глобальных переменных рядом
+// с кодом, который их использует (historySize, maxRooms, ...).
+type serverConfig struct {
+	Listen      string
+	WebSocket   string
+	Metrics     string
+	AdminSocket string
+
+	TLS     bool
+	TLSCert string
+	TLSKey  string
+
+	Store      string
+	CodeFormat string
+	CodeLength int
+
+	LogFormat  string
+	LogLevel   string
+	LogPrivacy bool
+
+	ShutdownTimeout time.Duration
+	RestartHint     time.Duration
+
+	DumpConfig bool
+}
+
+// Флаги, которые управляют самой загрузкой — их нет в файле и в dump
+var metaFlags = map[string]bool{"config": true, "dump-config": true}
+
+// loadConfig собирает настройки из файла, окружения и флагов
+// и проверяет их
+func loadConfig(args []string) (*serverConfig, error) {
+	cfg := &serverConfig{
+		Listen:          "0.0.0.0:8080",
+		CodeFormat:      "numeric",
+		LogFormat:       "logfmt",
+		LogLevel:        "info",
+		LogPrivacy:      true,
+		ShutdownTimeout: 10 * time.Second,
+	}
+
+	fs := flag.NewFlagSet("messenger-server", flag.ContinueOnError)
+
+	configFile := fs.String("config", os.Getenv("MESSENGER_CONFIG"), "JSON config file, keys are flag names")
+	fs.BoolVar(&cfg.DumpConfig, "dump-config", false, "Print the effective configuration as JSON and exit")
+
+	// Адреса
+	fs.StringVar(&cfg.Listen, "listen", cfg.Listen, "TCP listen address: one host:port (e.g. :9000 for all interfaces), not a list")
+	fs.StringVar(&cfg.WebSocket, "ws", "", "WebSocket listen address, e.g. :8081 (disabled if empty)")
+	fs.StringVar(&cfg.Metrics, "metrics", "", "HTTP address for Prometheus metrics, e.g. :9100 (disabled if empty)")
+	fs.StringVar(&cfg.AdminSocket, "admin-socket", "", "Unix socket for admin commands, e.g. "+defaultAdminSocket+" (disabled if empty)")
+
+	// TLS
+	fs.BoolVar(&cfg.TLS, "tls", false, "Enable TLS (self-signed cert is generated on first run)")
+	fs.StringVar(&cfg.TLSCert, "tls-cert", "", "TLS certificate file (PEM), default "+defaultCertFile)
+	fs.StringVar(&cfg.TLSKey, "tls-key", "", "TLS private key file (PEM), default "+defaultKeyFile)
+
+	// Комнаты
+	fs.StringVar(&cfg.Store, "store", "", "JSON file for persistent rooms (in-memory only if empty); messages and offline queues are never stored")
+	fs.StringVar(&cfg.CodeFormat, "code-format", cfg.CodeFormat, "Room code format: numeric, base32 or words")
+	fs.IntVar(&cfg.CodeLength, "code-length", 0, "Digits/characters/words per room code (0 = format default)")
+	fs.IntVar(&maxRooms, "max-rooms", maxRooms, "Max rooms on the server (0 = unlimited)")
+	fs.IntVar(&maxRoomClients, "max-clients", maxRoomClients, "Max clients connected to one room (0 = unlimited)")
+	fs.IntVar(&maxMessageSize, "max-message-size", maxMessageSize, "Max size of one encrypted chat message in bytes")
+	fs.IntVar(&historySize, "history", historySize, "Messages kept per room for late joiners (0 disables)")
+	fs.IntVar(&memberQueueSize, "queue-size", memberQueueSize, "Max messages queued per offline member of a persistent room (in memory: lost on restart)")
+	fs.DurationVar(&memberQueueAge, "queue-age", memberQueueAge, "Drop queued messages older than this")
+	fs.DurationVar(&knockTimeout, "knock-timeout", knockTimeout, "How long a join request waits for the room owner")
+	fs.DurationVar(&awayAfter, "away-after", awayAfter, "Show a member as away in the member list after this long without a message")
+	fs.StringVar(&duplicateNames, "duplicate-names", duplicateNames, "A name already used in the room is rejected (reject) or gets a number added (suffix)")
+	fs.DurationVar(&resumeWindow, "resume-window", resumeWindow, "How long a dropped client may reconnect without the password or knock")
+
+	// Отправка
+	fs.IntVar(&sendQueueSize, "send-queue", sendQueueSize, "Frames queued per client before it is disconnected as too slow")
+	fs.DurationVar(&writeTimeout, "write-timeout", writeTimeout, "Disconnect a client if one write takes longer than this")
+
+	// Лимиты скорости (ratelimit.go)
+	fs.Float64Var(&messageRate, "msg-rate", messageRate, "Chat messages per second per client (0 = unlimited)")
+	fs.IntVar(&messageBurst, "msg-burst", messageBurst, "Chat messages a client may send in a burst")
+	fs.Float64Var(&byteRate, "byte-rate", byteRate, "Chat bytes per second per client (0 = unlimited)")
+	fs.IntVar(&byteBurst, "byte-burst", byteBurst, "Chat bytes a client may send in a burst")
+	fs.Float64Var(&createRate, "create-rate", createRate, "Rooms created per minute per IP address (0 = unlimited)")
+	fs.IntVar(&createBurst, "create-burst", createBurst, "Rooms an IP address may create in a burst")
+	fs.IntVar(&maxConnsPerIP, "max-conns-per-ip", maxConnsPerIP, "Max simultaneous connections from one IP address (0 = unlimited)")
+	fs.Float64Var(&typingRate, "typing-rate", typingRate, "Typing notifications relayed per second per client (0 = unlimited)")
+	fs.IntVar(&typingBurst, "typing-burst", typingBurst, "Typing notifications a client may send in a burst")
+	fs.IntVar(&floodKick, "flood-kick", floodKick, "Disconnect a client after this many rate-limited messages in a row (0 = never)")
+
+	// Heartbeat
+	fs.DurationVar(&pingInterval, "ping-interval", pingInterval, "How often to ping clients that support heartbeats")
+	fs.DurationVar(&idleTimeout, "idle-timeout", idleTimeout, "Disconnect a heartbeat client that sends nothing for this long")
+	fs.DurationVar(&loginTimeout, "login-timeout", loginTimeout, "How long a client may take to enter a room")
+
+	// Логи
+	fs.StringVar(&cfg.LogFormat, "log-format", cfg.LogFormat, "Log format: logfmt or json")
+	fs.StringVar(&cfg.LogLevel, "log-level", cfg.LogLevel, "Log level: debug, info, warn or error")
+	fs.BoolVar(&cfg.LogPrivacy, "log-privacy", cfg.LogPrivacy, "Never log message bodies or full room codes")
+
+	// Остановка
+	fs.DurationVar(&cfg.ShutdownTimeout, "shutdown-timeout", cfg.ShutdownTimeout, "How long to wait for clients to be notified and disconnected on shutdown")
+	fs.DurationVar(&cfg.RestartHint, "restart-hint", 0, "Tell clients to reconnect after this long when shutting down (0 = no hint)")
+
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if fs.NArg() > 0 {
+		return nil, fmt.Errorf("unexpected argument %q", fs.Arg(0))
+	}
+
+	// Флаги из командной строки важнее всего — запоминаем их,
+	// чтобы применить ещё раз поверх файла и окружения
+	explicit := make(map[string]string)
+	fs.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = f.Value.String()
+	})
+
+	if *configFile != "" {
+		if err := applyConfigFile(fs, *configFile); err != nil {
+			return nil, err
+		}
+	}
+	if err := applyEnv(fs); err != nil {
+		return nil, err
+	}
+	for name, value := range explicit {
+		fs.Set(name, value)
+	}
+
+	// Если указан сертификат или ключ — TLS включается сам
+	if cfg.TLSCert != "" || cfg.TLSKey != "" {
+		cfg.TLS = true
+	}
+
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+
+	if cfg.DumpConfig {
+		dumpConfig(fs, os.Stdout)
+	}
+	return cfg, nil
+}
+
+// applyConfigFile читает JSON-файл {"имя-флага": значение}
+func applyConfigFile(fs *flag.FlagSet, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var values map[string]json.RawMessage
+	if err := json.Unmarshal(data, &values); err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+
+	for name, raw := range values {
+		if metaFlags[name] || fs.Lookup(name) == nil {
+			return fmt.Errorf("%s: unknown option %q", path, name)
+		}
+
+		// Строки — без кавычек, числа и bool — как есть
+		var value string
+		if err := json.Unmarshal(raw, &value); err != nil {
+			value = string(raw)
+		}
+		if err := fs.Set(name, value); err != nil {
+			return fmt.Errorf("%s: %s=%s: %v", path, name, value, err)
+		}
+	}
+	return nil
+}
+
+// applyEnv применяет переменные MESSENGER_*
+func applyEnv(fs *flag.FlagSet) error {
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		if err != nil || metaFlags[f.Name] {
+			return
+		}
+		name := envName(f.Name)
+		if value, ok := os.LookupEnv(name); ok {
+			if setErr := f.Value.Set(value); setErr != nil {
+				err = fmt.Errorf("%s=%q: %v", name, value, setErr)
+			}
+		}
+	})
+	return err
+}
+
+// envName: "max-rooms" → "MESSENGER_MAX_ROOMS"
+func envName(flagName string) string {
+	return "MESSENGER_" + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// validate проверяет настройки целиком и сообщает обо всех ошибках сразу
+func (cfg *serverConfig) validate() error {
+	var problems []string
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			problems = append(problems, fmt.Sprintf(format, args...))
+		}
+	}
+
+	check(validAddr(cfg.Listen), "listen: %q is not a host:port address", cfg.Listen)
+	check(cfg.WebSocket == "" || validAddr(cfg.WebSocket), "ws: %q is not a host:port address", cfg.WebSocket)
+	check(cfg.Metrics == "" || validAddr(cfg.Metrics), "metrics: %q is not a host:port address", cfg.Metrics)
+
+	if _, err := NewCodeGenerator(cfg.CodeFormat, cfg.CodeLength); err != nil {
+		problems = append(problems, "code-format: "+err.Error())
+	}
+
+	check(maxRooms >= 0, "max-rooms: must be 0 or more")
+	check(maxRoomClients >= 0, "max-clients: must be 0 or more")
+	check(maxMessageSize > 0 && maxMessageSize <= protocol.MaxPayloadSize-chatFrameOverhead,
+		"max-message-size: must be between 1 and %d", protocol.MaxPayloadSize-chatFrameOverhead)
+	check(historySize >= 0, "history: must be 0 or more")
+	check(memberQueueSize >= 0, "queue-size: must be 0 or more")
+	check(memberQueueAge > 0, "queue-age: must be positive")
+	check(knockTimeout > 0, "knock-timeout: must be positive")
+	check(resumeWindow >= 0, "resume-window: must be 0 or more")
+	check(awayAfter > 0, "away-after: must be positive")
+	check(duplicateNames == "reject" || duplicateNames == "suffix",
+		"duplicate-names: %q is not reject or suffix", duplicateNames)
+
+	// Подтверждение и вся история при входе должны влезть в очередь
+	check(sendQueueSize > historySize && sendQueueSize > memberQueueSize,
+		"send-queue: must be larger than history and queue-size")
+	check(writeTimeout > 0, "write-timeout: must be positive")
+
+	check(messageRate >= 0, "msg-rate: must be 0 or more")
+	check(messageRate == 0 || messageBurst >= 1, "msg-burst: must be 1 or more")
+	check(byteRate >= 0, "byte-rate: must be 0 or more")
+	// Иначе сообщение максимального размера не пройдёт никогда
+	check(byteRate == 0 || byteBurst >= maxMessageSize, "byte-burst: must be at least max-message-size")
+	check(createRate >= 0, "create-rate: must be 0 or more")
+	check(createRate == 0 || createBurst >= 1, "create-burst: must be 1 or more")
+	check(maxConnsPerIP >= 0, "max-conns-per-ip: must be 0 or more")
+	check(typingRate >= 0, "typing-rate: must be 0 or more")
+	check(typingRate == 0 || typingBurst >= 1, "typing-burst: must be 1 or more")
+	check(floodKick >= 0, "flood-kick: must be 0 or more")
+
+	check(pingInterval > 0, "ping-interval: must be positive")
+	check(idleTimeout > pingInterval, "idle-timeout: must be longer than ping-interval")
+	check(loginTimeout > 0, "login-timeout: must be positive")
+
+	if _, err := newLogger(io.Discard, cfg.LogFormat, cfg.LogLevel, cfg.LogPrivacy); err != nil {
+		problems = append(problems, "log: "+err.Error())
+	}
+
+	check(cfg.ShutdownTimeout > 0, "shutdown-timeout: must be positive")
+	check(cfg.RestartHint >= 0, "restart-hint: must be 0 or more")
+
+	if len(problems) > 0 {
+		return errors.New("invalid configuration:\n  " + strings.Join(problems, "\n  "))
+	}
+	return nil
+}
+
+func validAddr(addr string) bool {
+	_, _, err := net.SplitHostPort(addr)
+	return err == nil
+}
+
+// dumpConfig печатает итоговые настройки в формате файла конфигурации
+func dumpConfig(fs *flag.FlagSet, w io.Writer) {
+	values := make(map[string]interface{})
+	fs.VisitAll(func(f *flag.Flag) {
+		if metaFlags[f.Name] {
+			return
+		}
+		value := f.Value.(flag.Getter).Get()
+		if d, ok := value.(time.Duration); ok {
+			value = d.String()
+		}
+		values[f.Name] = value
+	})
+
+	data, _ := json.MarshalIndent(values, "", "  ")
+	fmt.Fprintln(w, string(data))
+}
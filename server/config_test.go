@@ -0,0 +1,175 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// restoreLimits возвращает глобальные настройки, которые меняет loadConfig,
+// после теста
+func restoreLimits(t *testing.T) {
+	rooms, history, sendQueue, queue := maxRooms, historySize, sendQueueSize, memberQueueSize
+	ping, idle := pingInterval, idleTimeout
+	rate, burst := byteRate, byteBurst
+	names := duplicateNames
+	t.Cleanup(func() {
+		maxRooms, historySize, sendQueueSize, memberQueueSize = rooms, history, sendQueue, queue
+		pingInterval, idleTimeout = ping, idle
+		byteRate, byteBurst = rate, burst
+		duplicateNames = names
+	})
+}
+
+func TestLoadConfigPrecedence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "server.json")
+	file := `{"max-rooms": 10, "log-format": "json", "listen": ":9001"}`
+	if err := os.WriteFile(path, []byte(file), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		env       map[string]string
+		args      []string
+		rooms     int
+		logFormat string
+		listen    string
+	}{
+		{"defaults", nil, nil, 0, "logfmt", "0.0.0.0:8080"},
+		{"file", nil, []string{"-config", path}, 10, "json", ":9001"},
+		{"file from env", map[string]string{"MESSENGER_CONFIG": path}, nil, 10, "json", ":9001"},
+		{"env over file",
+			map[string]string{"MESSENGER_MAX_ROOMS": "20", "MESSENGER_LISTEN": ":9002"},
+			[]string{"-config", path}, 20, "json", ":9002"},
+		{"flag over env and file",
+			map[string]string{"MESSENGER_MAX_ROOMS": "20", "MESSENGER_LOG_FORMAT": "logfmt"},
+			[]string{"-config", path, "-max-rooms=30", "-log-format=json"}, 30, "json", ":9001"},
+		{"flag over env", map[string]string{"MESSENGER_MAX_ROOMS": "20"}, []string{"-max-rooms=30"}, 30, "logfmt", "0.0.0.0:8080"},
+		{"flag set to the default still wins",
+			map[string]string{"MESSENGER_MAX_ROOMS": "20"},
+			[]string{"-config", path, "-max-rooms=0"}, 0, "json", ":9001"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			restoreLimits(t)
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+
+			cfg, err := loadConfig(tt.args)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if maxRooms != tt.rooms {
+				t.Errorf("max-rooms = %d, want %d", maxRooms, tt.rooms)
+			}
+			if cfg.LogFormat != tt.logFormat {
+				t.Errorf("log-format = %q, want %q", cfg.LogFormat, tt.logFormat)
+			}
+			if cfg.Listen != tt.listen {
+				t.Errorf("listen = %q, want %q", cfg.Listen, tt.listen)
+			}
+		})
+	}
+}
+
+func TestLoadConfigBadSource(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	tests := []struct {
+		name string
+		env  map[string]string
+		args []string
+		want string // часть текста ошибки
+	}{
+		{"missing file", nil, []string{"-config", filepath.Join(dir, "nope.json")}, "no such file"},
+		{"file not JSON", nil, []string{"-config", write("bad.json", "max-rooms = 10")}, "bad.json"},
+		{"unknown file key", nil, []string{"-config", write("unknown.json", `{"max-room": 10}`)}, `unknown option "max-room"`},
+		{"meta flag in file", nil, []string{"-config", write("meta.json", `{"dump-config": true}`)}, `unknown option "dump-config"`},
+		{"bad file value", nil, []string{"-config", write("value.json", `{"max-rooms": "many"}`)}, "max-rooms=many"},
+		{"bad env value", map[string]string{"MESSENGER_IDLE_TIMEOUT": "soon"}, nil, "MESSENGER_IDLE_TIMEOUT"},
+		{"extra argument", nil, []string{"9000"}, `unexpected argument "9000"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			restoreLimits(t)
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+
+			_, err := loadConfig(tt.args)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("loadConfig() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want string // "" — настройки верные, иначе часть текста ошибки
+	}{
+		{"defaults", nil, ""},
+		{"listen on all interfaces", []string{"-listen=:9000"}, ""},
+		{"listen without port", []string{"-listen=localhost"}, "listen:"},
+		{"listen list", []string{"-listen=:9000,:9001"}, "listen:"},
+		{"bad ws address", []string{"-ws=8081"}, "ws:"},
+		{"send queue equal to history", []string{"-send-queue=50", "-history=50"}, "send-queue:"},
+		{"send queue below history", []string{"-send-queue=10", "-history=50"}, "send-queue:"},
+		{"send queue below offline queue", []string{"-send-queue=60", "-history=50", "-queue-size=100"}, "send-queue:"},
+		{"send queue above both", []string{"-send-queue=101", "-history=50", "-queue-size=100"}, ""},
+		{"idle timeout not above ping", []string{"-ping-interval=30s", "-idle-timeout=30s"}, "idle-timeout:"},
+		{"byte burst below message size", []string{"-byte-rate=1000", "-byte-burst=10"}, "byte-burst:"},
+		{"byte burst unused without rate", []string{"-byte-rate=0", "-byte-burst=10"}, ""},
+		{"negative max rooms", []string{"-max-rooms=-1"}, "max-rooms:"},
+		{"unknown duplicate mode", []string{"-duplicate-names=ignore"}, "duplicate-names:"},
+		{"unknown log format", []string{"-log-format=xml"}, "log:"},
+		{"unknown code format", []string{"-code-format=emoji"}, "code-format:"},
+		{"zero shutdown timeout", []string{"-shutdown-timeout=0"}, "shutdown-timeout:"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			restoreLimits(t)
+
+			_, err := loadConfig(tt.args)
+			if tt.want == "" {
+				if err != nil {
+					t.Errorf("loadConfig() error = %v, want none", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("loadConfig() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateReportsEverything(t *testing.T) {
+	restoreLimits(t)
+
+	_, err := loadConfig([]string{"-listen=nowhere", "-send-queue=1", "-ping-interval=1m", "-idle-timeout=" + time.Second.String()})
+	if err == nil {
+		t.Fatal("invalid configuration accepted")
+	}
+	for _, want := range []string{"listen:", "send-queue:", "idle-timeout:"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error does not mention %s:\n%v", want, err)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+// ============================================================
+// ЛИЧНЫЕ СООБЩЕНИЯ (DIRECT)
+// ============================================================
+//
+// Клиент с возможностью "direct" присылает в hello свой публичный
+// ключ. Ключи участников видны в ответе на who, и по ним два клиента
+// выводят общий ключ, которого нет у остальных участников комнаты
+// (у них есть только общий ключ комнаты).
+//
+// От сервера это само по себе не защищает: ключи раздаёт он, и
+// подменённый сервер мог бы выдать обоим свой и читать переписку.
+// Поэтому клиент пользуется ключом только после того, как люди
+// сверили его отпечаток по другому каналу (/fingerprint, /verify).
+//
+// Сервер ищет получателя по имени в той же комнате и отправляет
+// сообщение только ему, подставив имя и ключ отправителя:
+//   - в историю и офлайн-очереди не попадает
+//   - лимиты и размер — как у chat
+//   - получателя нет в комнате — ошибка user_not_found
+
+import (
+	"fmt"
+	"time"
+
+	"messenger-protocol"
+)
+
+// relayDirect передаёт личное сообщение от client одному участнику room
+func relayDirect(client *Client, room *Room, frame protocol.Frame) {
+	if !protocol.HasCapability(client.Capabilities, protocol.CapDirect) {
+		return
+	}
+
+	var direct protocol.Direct
+	if err := frame.Decode(&direct); err != nil {
+		client.Send(errorFrame(protocol.ErrBadRequest, "Invalid private message"))
+		return
+	}
+	if err := direct.CheckLimits(); err != nil {
+		client.Send(errorFrame(protocol.ErrFieldTooLong, err.Error()))
+		return
+	}
+	if len(direct.Body) > maxMessageSize {
+		client.Send(errorFrame(protocol.ErrMessageTooLarge,
+			fmt.Sprintf("Message is too large (limit %d bytes)", maxMessageSize)))
+		return
+	}
+	if !throttleMessage(client, room, len(direct.Body)) {
+		return
+	}
+
+	// Имя и ключ отправителя ставит сервер — клиент не может подделать
+	f, err := protocol.NewFrame(protocol.TypeDirect, protocol.Direct{
+		From: client.Username,
+		To:   direct.To,
+		Body: direct.Body,
+		Key:  client.PublicKey,
+		Time: time.Now().Unix(),
+	})
+	if err != nil {
+		return
+	}
+
+	if !room.SendTo(direct.To, f, protocol.CapDirect) {
+		client.Send(errorFrame(protocol.ErrUserNotFound,
+			fmt.Sprintf("%s is not in the room or can't receive private messages", direct.To)))
+		return
+	}
+
+	metricDirect.Inc()
+	logger.Debug("direct_relayed", "room", room.Code, "user", client.Username, "to", direct.To, "bytes", len(direct.Body), "body", direct.Body)
+}
@@ -0,0 +1,150 @@
+package main
+
+// ============================================================
+// fileStore — комнаты в JSON-файле
+// ============================================================
+//
+// Работает как memoryStore, но после каждого изменения записывает
+// постоянные (Persistent) комнаты в файл. При старте сервера они
+// загружаются обратно — уже без клиентов, люди просто подключаются
+// по тому же коду.
+//
+// Обычные комнаты в файл не попадают: они удаляются, когда из них
+// выходит последний клиент, а после перезапуска клиентов нет.
+//
+// Сообщений в файле нет: история и офлайн-очереди участников
+// (members.go) после перезапуска начинаются заново.
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// roomRecord — то, что о комнате хранится на диске
+type roomRecord struct {
+	Code      string       `json:"code"`
+	CreatedAt time.Time    `json:"created_at"`
+	Owner     string       `json:"owner"`
+	Settings  RoomSettings `json:"settings"`
+	Members   []string     `json:"members,omitempty"`
+
+	// SHA-256 токенов участников по именам (у файлов старых версий нет)
+	MemberTokens map[string]string `json:"member_tokens,omitempty"`
+}
+
+type fileStore struct {
+	*memoryStore
+	path   string
+	saveMu sync.Mutex // одна запись файла за раз
+}
+
+// NewFileStore открывает (или создаёт) файловое хранилище
+func NewFileStore(path string) (*fileStore, error) {
+	s := &fileStore{memoryStore: NewMemoryStore(), path: path}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil // первый запуск — файла ещё нет
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var records []roomRecord
+	if err := json.Unmarshal(data, &records); err != nil {
+		return nil, err
+	}
+
+	for _, rec := range records {
+		room := NewRoom(rec.Code, rec.Owner, rec.Settings)
+		room.CreatedAt = rec.CreatedAt
+		for _, name := range rec.Members {
+			room.members[name] = &member{Username: name, tokenHash: rec.MemberTokens[name], restored: true}
+		}
+		s.rooms[rec.Code] = room
+	}
+	return s, nil
+}
+
+func (s *fileStore) Create(room *Room) error {
+	if err := s.memoryStore.Create(room); err != nil {
+		return err
+	}
+	return s.save()
+}
+
+func (s *fileStore) Update(room *Room) error {
+	return s.save()
+}
+
+func (s *fileStore) Delete(code string) error {
+	if err := s.memoryStore.Delete(code); err != nil {
+		return err
+	}
+	return s.save()
+}
+
+func (s *fileStore) Close() error {
+	return s.save()
+}
+
+// save записывает постоянные комнаты в файл
+//
+// Сначала пишем во временный файл, потом rename — так при падении
+// посреди записи старый файл остаётся целым.
+func (s *fileStore) save() error {
+	s.saveMu.Lock()
+	defer s.saveMu.Unlock()
+
+	records := make([]roomRecord, 0)
+	for _, room := range s.List() {
+		if !room.Settings.Persistent {
+			continue
+		}
+		records = append(records, roomRecord{
+			Code:      room.Code,
+			CreatedAt: room.CreatedAt,
+			Owner:     room.OwnerName(),
+			Settings:  room.Settings,
+			Members:   room.MemberNames(),
+
+			MemberTokens: room.MemberTokens(),
+		})
+		sort.Strings(records[len(records)-1].Members)
+	}
+
+	// Стабильный порядок — удобно смотреть diff файла
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].Code < records[j].Code
+	})
+
+	data, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), ".rooms-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // после успешного rename ничего не удалит
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), s.path)
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestFileStoreRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rooms.json")
+
+	hash, salt, err := hashSecret("hunter2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	settings := RoomSettings{
+		Persistent:     true,
+		Knock:          true,
+		SecretHash:     hash,
+		SecretSalt:     salt,
+		OwnerTokenHash: hashToken("owner-token"),
+	}
+
+	room := NewRoom("12345678", "alice", settings)
+	room.CreatedAt = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	room.members["bob"] = &member{Username: "bob", tokenHash: hashToken("bob-token")}
+	room.members["carol"] = &member{Username: "carol"} // ещё без токена
+	temporary := NewRoom("87654321", "dave", RoomSettings{})
+
+	s, err := NewFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Create(room); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Create(temporary); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Как после перезапуска сервера
+	s, err = NewFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Count() != 1 || s.Get(temporary.Code) != nil {
+		t.Errorf("loaded %d rooms, want only the persistent one", s.Count())
+	}
+
+	got := s.Get(room.Code)
+	if got == nil {
+		t.Fatal("persistent room not loaded")
+	}
+	if got.Code != room.Code || got.OwnerName() != "alice" || !got.CreatedAt.Equal(room.CreatedAt) {
+		t.Errorf("loaded %s owned by %s, created %v", got.Code, got.OwnerName(), got.CreatedAt)
+	}
+	if got.Settings != settings {
+		t.Errorf("settings = %+v, want %+v", got.Settings, settings)
+	}
+	if !checkSecret("hunter2", got.Settings.SecretHash, got.Settings.SecretSalt) {
+		t.Error("room password no longer accepted")
+	}
+
+	names := got.MemberNames()
+	sort.Strings(names)
+	if !reflect.DeepEqual(names, []string{"bob", "carol"}) {
+		t.Errorf("members = %v, want [bob carol]", names)
+	}
+	if tokens := got.MemberTokens(); !reflect.DeepEqual(tokens, map[string]string{"bob": hashToken("bob-token")}) {
+		t.Errorf("member tokens = %v", tokens)
+	}
+}
+
+func TestFileStoreBadFile(t *testing.T) {
+	good := `[{"code":"12345678","created_at":"2024-05-01T12:00:00Z","owner":"alice","settings":{"persistent":true,"knock":false}}]`
+
+	tests := []struct {
+		name    string
+		content string // "" — файла нет
+		ok      bool
+		rooms   int
+	}{
+		{"no file yet", "", true, 0},
+		{"valid", good, true, 1},
+		{"empty list", "[]", true, 0},
+		{"cut off mid-write", good[:len(good)/2], false, 0},
+		{"empty file", " ", false, 0},
+		{"not JSON", "rooms: 12345678", false, 0},
+		{"wrong shape", `{"code":"12345678"}`, false, 0},
+		{"wrong field type", `[{"code":12345678}]`, false, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "rooms.json")
+			if tt.content != "" {
+				if err := os.WriteFile(path, []byte(tt.content), 0600); err != nil {
+					t.Fatal(err)
+				}
+			}
+			// Недописанный временный файл от упавшей записи не мешает
+			if err := os.WriteFile(filepath.Join(dir, ".rooms-1.tmp"), []byte(good[:10]), 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			s, err := NewFileStore(path)
+			if (err == nil) != tt.ok {
+				t.Fatalf("NewFileStore() error = %v, want ok: %v", err, tt.ok)
+			}
+			if err == nil && s.Count() != tt.rooms {
+				t.Errorf("loaded %d rooms, want %d", s.Count(), tt.rooms)
+			}
+		})
+	}
+}
@@ -1,3 +1,7 @@
 module messenger-server
 
 go 1.18
+
+require messenger-protocol v0.0.0
+
+replace messenger-protocol => ../protocol
@@ -0,0 +1,188 @@
+package main
+
+// ============================================================
+// ЗАЩИТА ОТ ПЕРЕБОРА КОДОВ КОМНАТ
+// ============================================================
+//
+// Коды комнат короткие (сколько их всего — зависит от формата,
+// см. code.go), поэтому без ограничений их можно перебрать.
+// joinGuard считает неудачные попытки входа (нет такой комнаты,
+// неверный пароль):
+//   - по IP: после каждой неудачи пауза растёт вдвое (backoff),
+//     после joinBanAfter неудач подряд — временный бан
+//   - глобально: если со всех IP вместе неудач слишком много
+//     (распределённый перебор), join временно отклоняется — но только
+//     для IP, у которых уже были неудачи. Адрес без неудач с верным
+//     кодом входит всегда, иначе перебором можно было бы запереть
+//     сервер для всех.
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+// Настройки защиты
+var (
+	joinBackoffBase  = 1 * time.Second  // пауза после первой неудачи
+	joinBackoffMax   = 30 * time.Second // максимальная пауза
+	joinBanAfter     = 10               // неудач подряд до бана
+	joinBanTime      = 15 * time.Minute // длительность бана
+	joinFailWindow   = 10 * time.Minute // через сколько счётчик IP обнуляется
+	joinGlobalLimit  = 100              // неудач в минуту со всех IP
+	joinGlobalWindow = time.Minute
+)
+
+// ipAttempts — история неудач одного IP
+type ipAttempts struct {
+	failures    int       // неудач подряд
+	lastFailure time.Time // когда была последняя
+	nextAllowed time.Time // раньше этого времени попытки отклоняются
+	bannedUntil time.Time // бан
+}
+
+// joinGuard — состояние защиты (один на сервер)
+type joinGuard struct {
+	mu sync.Mutex
+	ip map[string]*ipAttempts
+
+	globalStart    time.Time // начало текущего глобального окна
+	globalFailures int       // неудач в текущем окне
+	lastSweep      time.Time
+
+	stats guardStats
+}
+
+// guardStats — счётчики для мониторинга (metrics.go)
+type guardStats struct {
+	FailedJoins  int64 // всего неудачных попыток
+	Throttled    int64 // попыток отклонено из-за backoff/бана/лимита
+	Bans         int64 // сколько раз IP попадал в бан
+	GlobalLimits int64 // сколько раз срабатывал глобальный лимит
+}
+
+// Stats возвращает копию счётчиков
+func (g *joinGuard) Stats() guardStats {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return g.stats
+}
+
+// guard — защита, общая для всех клиентов
+var guard = &joinGuard{ip: make(map[string]*ipAttempts)}
+
+// remoteIP возвращает IP без порта
+func remoteIP(conn net.Conn) string {
+	host, _, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil {
+		return conn.RemoteAddr().String()
+	}
+	return host
+}
+
+// Allow проверяет, можно ли этому IP сейчас пытаться войти
+// Если нельзя — возвращает сколько подождать.
+// Глобальный лимит действует только на IP с недавними неудачами.
+func (g *joinGuard) Allow(ip string) (bool, time.Duration) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := time.Now()
+	g.sweep(now)
+
+	a, ok := g.ip[ip]
+	if !ok {
+		return true, 0 // неудач не было — глобальный лимит не касается
+	}
+
+	if now.Before(a.bannedUntil) {
+		g.stats.Throttled++
+		return false, a.bannedUntil.Sub(now)
+	}
+	if now.Before(a.nextAllowed) {
+		g.stats.Throttled++
+		return false, a.nextAllowed.Sub(now)
+	}
+
+	if now.Sub(a.lastFailure) <= joinFailWindow && g.globalExceeded(now) {
+		g.stats.Throttled++
+		return false, g.globalStart.Add(joinGlobalWindow).Sub(now)
+	}
+
+	return true, 0
+}
+
+// Fail записывает неудачную попытку входа
+func (g *joinGuard) Fail(ip, code string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := time.Now()
+	g.stats.FailedJoins++
+
+	a, ok := g.ip[ip]
+	if !ok || now.Sub(a.lastFailure) > joinFailWindow {
+		a = &ipAttempts{}
+		g.ip[ip] = a
+	}
+
+	a.failures++
+	a.lastFailure = now
+
+	// Пауза удваивается: 1s, 2s, 4s, ... до joinBackoffMax
+	backoff := joinBackoffBase << uint(a.failures-1)
+	if backoff > joinBackoffMax || backoff <= 0 {
+		backoff = joinBackoffMax
+	}
+	a.nextAllowed = now.Add(backoff)
+
+	if a.failures >= joinBanAfter && now.After(a.bannedUntil) {
+		a.bannedUntil = now.Add(joinBanTime)
+		g.stats.Bans++
+		logger.Warn("join_ban", "remote_addr", ip, "failures", a.failures, "duration", joinBanTime, "room", code)
+	}
+
+	// Глобальное окно
+	if now.Sub(g.globalStart) > joinGlobalWindow {
+		g.globalStart = now
+		g.globalFailures = 0
+	}
+	g.globalFailures++
+	if g.globalFailures == joinGlobalLimit {
+		g.stats.GlobalLimits++
+		logger.Warn("join_global_limit", "failures", g.globalFailures, "window", joinGlobalWindow)
+	}
+}
+
+// Success сбрасывает счётчик IP после удачного входа
+func (g *joinGuard) Success(ip string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if a, ok := g.ip[ip]; ok && time.Now().After(a.bannedUntil) {
+		delete(g.ip, ip)
+	}
+}
+
+// globalExceeded — сработал ли глобальный лимит (под g.mu)
+func (g *joinGuard) globalExceeded(now time.Time) bool {
+	if now.Sub(g.globalStart) > joinGlobalWindow {
+		return false
+	}
+	return g.globalFailures >= joinGlobalLimit
+}
+
+// sweep раз в минуту удаляет записи, которые уже ни на что не влияют
+func (g *joinGuard) sweep(now time.Time) {
+	if now.Sub(g.lastSweep) < time.Minute {
+		return
+	}
+	g.lastSweep = now
+
+	for ip, a := range g.ip {
+		if now.After(a.bannedUntil) && now.Sub(a.lastFailure) > joinFailWindow {
+			delete(g.ip, ip)
+		}
+	}
+}
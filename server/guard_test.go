@@ -0,0 +1,183 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"messenger-protocol"
+)
+
+// newTestGuard — отдельная защита с тихим логом (бан пишет в лог)
+func newTestGuard(t *testing.T) *joinGuard {
+	quietLogger(t)
+	return &joinGuard{ip: make(map[string]*ipAttempts)}
+}
+
+// expire делает так, будто пауза после последней неудачи уже прошла
+func (g *joinGuard) expire(ip string) {
+	g.ip[ip].nextAllowed = time.Now().Add(-time.Second)
+}
+
+func TestJoinGuardBackoff(t *testing.T) {
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{1, joinBackoffBase},
+		{2, 2 * joinBackoffBase},
+		{3, 4 * joinBackoffBase},
+		{5, 16 * joinBackoffBase},
+		{6, joinBackoffMax}, // 32s обрезается до максимума
+		{9, joinBackoffMax},
+	}
+
+	for _, tt := range tests {
+		g := newTestGuard(t)
+		for i := 0; i < tt.failures; i++ {
+			g.Fail("10.0.0.1", "12345678")
+		}
+
+		ok, wait := g.Allow("10.0.0.1")
+		if ok {
+			t.Errorf("%d failures: allowed, want a wait of %v", tt.failures, tt.want)
+			continue
+		}
+		if wait > tt.want || wait < tt.want-time.Second {
+			t.Errorf("%d failures: wait %v, want about %v", tt.failures, wait, tt.want)
+		}
+
+		// Пауза касается только этого IP
+		if ok, _ := g.Allow("10.0.0.2"); !ok {
+			t.Errorf("%d failures of another IP: 10.0.0.2 not allowed", tt.failures)
+		}
+	}
+}
+
+func TestJoinGuardBan(t *testing.T) {
+	g := newTestGuard(t)
+	ip := "10.0.0.1"
+
+	for i := 0; i < joinBanAfter-1; i++ {
+		g.Fail(ip, "12345678")
+	}
+	g.expire(ip)
+	if ok, _ := g.Allow(ip); !ok {
+		t.Fatalf("%d failures: banned too early", joinBanAfter-1)
+	}
+
+	g.Fail(ip, "12345678")
+	g.expire(ip)
+	ok, wait := g.Allow(ip)
+	if ok || wait < joinBanTime-time.Second {
+		t.Fatalf("%d failures: Allow = %v, %v; want a ban of %v", joinBanAfter, ok, wait, joinBanTime)
+	}
+	if stats := g.Stats(); stats.Bans != 1 || stats.FailedJoins != int64(joinBanAfter) {
+		t.Errorf("stats = %+v, want 1 ban and %d failed joins", stats, joinBanAfter)
+	}
+
+	// Удачный вход (например, с другой вкладки) бан не снимает
+	g.Success(ip)
+	if ok, _ := g.Allow(ip); ok {
+		t.Error("ban lifted by Success")
+	}
+}
+
+func TestJoinGuardSuccessResets(t *testing.T) {
+	g := newTestGuard(t)
+	ip := "10.0.0.1"
+
+	for i := 0; i < 3; i++ {
+		g.Fail(ip, "12345678")
+	}
+	g.Success(ip)
+	if ok, _ := g.Allow(ip); !ok {
+		t.Fatal("not allowed after Success")
+	}
+
+	// Счёт неудач начинается заново: пауза снова минимальная
+	g.Fail(ip, "12345678")
+	if _, wait := g.Allow(ip); wait > joinBackoffBase {
+		t.Errorf("wait after Success and one failure = %v, want at most %v", wait, joinBackoffBase)
+	}
+}
+
+func TestJoinGuardGlobalLimit(t *testing.T) {
+	old := joinGlobalLimit
+	joinGlobalLimit = 3
+	t.Cleanup(func() { joinGlobalLimit = old })
+
+	g := newTestGuard(t)
+	for _, ip := range []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"} {
+		g.Fail(ip, "12345678")
+		g.expire(ip)
+	}
+
+	// Перебор с многих адресов останавливается...
+	if ok, wait := g.Allow("10.0.0.1"); ok || wait <= 0 || wait > joinGlobalWindow {
+		t.Errorf("failing IP over the global limit: Allow = %v, %v", ok, wait)
+	}
+
+	// ...но адрес без неудач входит как обычно
+	if ok, _ := g.Allow("10.0.0.99"); !ok {
+		t.Error("clean IP locked out by the global limit")
+	}
+
+	// Неудачи, которые уже устарели, тоже не в счёт
+	g.ip["10.0.0.2"].lastFailure = time.Now().Add(-joinFailWindow - time.Second)
+	if ok, _ := g.Allow("10.0.0.2"); !ok {
+		t.Error("IP with only old failures locked out by the global limit")
+	}
+
+	if stats := g.Stats(); stats.GlobalLimits != 1 {
+		t.Errorf("GlobalLimits = %d, want 1", stats.GlobalLimits)
+	}
+}
+
+func TestJoinFailuresCountAlike(t *testing.T) {
+	// Неверный код и неверный пароль стоят одинаково: после любой
+	// из них следующая попытка сразу получает паузу
+	quietLogger(t)
+	withStore(t, NewMemoryStore())
+
+	hash, salt, err := hashSecret("hunter2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Create(NewRoom("12345678", "alice", RoomSettings{SecretHash: hash, SecretSalt: salt})); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		join protocol.Join
+		want string
+	}{
+		{"unknown code", protocol.Join{Code: "87654321", Secret: "hunter2"}, protocol.ErrRoomNotFound},
+		{"wrong password", protocol.Join{Code: "12345678", Secret: "hunter3"}, protocol.ErrBadSecret},
+		{"no password", protocol.Join{Code: "12345678"}, protocol.ErrBadSecret},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			old := guard
+			guard = newTestGuard(t)
+			t.Cleanup(func() { guard = old })
+
+			f, err := protocol.NewFrame(protocol.TypeJoin, tt.join)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i, want := range []string{tt.want, protocol.ErrTooManyAttempts} {
+				_, err := joinRoom(readingClient(t, "bob"), f)
+				var protoErr *protocol.Error
+				if !errors.As(err, &protoErr) || protoErr.Code != want {
+					t.Fatalf("attempt %d: %v, want %s", i+1, err, want)
+				}
+			}
+			if stats := guard.Stats(); stats.FailedJoins != 1 || stats.Throttled != 1 {
+				t.Errorf("stats = %+v, want 1 failure and 1 throttled attempt", stats)
+			}
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+// ============================================================
+// HEARTBEAT: PING/PONG И ТАЙМАУТЫ ЧТЕНИЯ
+// ============================================================
+//
+// Если у клиента пропала сеть, TCP может молчать очень долго,
+// и клиент так и висел бы в Room.Clients.
+//
+// С клиентами, у которых есть возможность "heartbeat":
+//   - сервер шлёт ping каждые -ping-interval
+//   - клиент обязан присылать хоть что-то (pong, ping, сообщение)
+//     не реже чем раз в -idle-timeout, иначе соединение закрывается
+//     и комната получает "left"
+//
+// Старые клиенты без "heartbeat" не пингуются и по молчанию не отключаются.
+//
+// До входа в комнату (handshake, create/join, ввод пароля) действует
+// -login-timeout: человек может долго набирать код комнаты.
+
+import (
+	"errors"
+	"net"
+	"os"
+	"time"
+
+	"messenger-protocol"
+)
+
+// Настройки (флаги -ping-interval, -idle-timeout, -login-timeout)
+var (
+	pingInterval = 30 * time.Second
+	idleTimeout  = 90 * time.Second
+	loginTimeout = 5 * time.Minute
+)
+
+// startHeartbeat шлёт клиенту ping, пока соединение не закроется
+func (c *Client) startHeartbeat() {
+	go func() {
+		ticker := time.NewTicker(pingInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				f, err := protocol.NewFrame(protocol.TypePing, protocol.Ping{Time: time.Now().UnixMilli()})
+				if err != nil || c.Send(f) != nil {
+					return
+				}
+			case <-c.closing:
+				return
+			}
+		}
+	}()
+}
+
+// answerPing отвечает pong с тем же временем
+func answerPing(client *Client, frame protocol.Frame) {
+	var ping protocol.Ping
+	if err := frame.Decode(&ping); err != nil {
+		return
+	}
+
+	f, err := protocol.NewFrame(protocol.TypePong, ping)
+	if err == nil {
+		client.Send(f)
+	}
+}
+
+// extendDeadline даёт клиенту ещё timeout на следующий фрейм
+// (0 — ждать сколько угодно)
+func extendDeadline(conn net.Conn, timeout time.Duration) {
+	if timeout <= 0 {
+		conn.SetReadDeadline(time.Time{})
+		return
+	}
+	conn.SetReadDeadline(time.Now().Add(timeout))
+}
+
+// isTimeout сообщает, что чтение прервал дедлайн
+func isTimeout(err error) bool {
+	return errors.Is(err, os.ErrDeadlineExceeded)
+}
@@ -0,0 +1,53 @@
+package main
+
+// ============================================================
+// ИСТОРИЯ КОМНАТЫ
+// ============================================================
+//
+// Кольцевой буфер последних N chat-сообщений комнаты.
+// Сервер хранит только шифротекст — прочитать его он всё равно не может.
+// Новый клиент получает эти сообщения сразу после ack.
+
+import "messenger-protocol"
+
+// historySize — сколько сообщений помнит каждая комната (0 = без истории)
+var historySize = 50
+
+// historyBuffer — кольцевой буфер фиксированного размера
+//
+// Когда буфер заполнен, новое сообщение затирает самое старое.
+type historyBuffer struct {
+	items []protocol.Chat
+	next  int  // куда писать следующее сообщение
+	full  bool // буфер уже хотя бы раз заполнился
+}
+
+func newHistoryBuffer(size int) *historyBuffer {
+	return &historyBuffer{items: make([]protocol.Chat, size)}
+}
+
+// Add добавляет сообщение, вытесняя самое старое
+func (h *historyBuffer) Add(chat protocol.Chat) {
+	if len(h.items) == 0 {
+		return
+	}
+
+	h.items[h.next] = chat
+	h.next = (h.next + 1) % len(h.items)
+	if h.next == 0 {
+		h.full = true
+	}
+}
+
+// All возвращает сообщения от старых к новым
+func (h *historyBuffer) All() []protocol.Chat {
+	if !h.full {
+		return append([]protocol.Chat(nil), h.items[:h.next]...)
+	}
+
+	// Буфер полон: самое старое лежит на позиции next
+	result := make([]protocol.Chat, 0, len(h.items))
+	result = append(result, h.items[h.next:]...)
+	result = append(result, h.items[:h.next]...)
+	return result
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"messenger-protocol"
+)
+
+// seqs — номера сообщений из истории, по порядку
+func seqs(chats []protocol.Chat) []uint64 {
+	list := make([]uint64, 0, len(chats))
+	for _, chat := range chats {
+		list = append(list, chat.Seq)
+	}
+	return list
+}
+
+func TestHistoryBuffer(t *testing.T) {
+	tests := []struct {
+		name  string
+		size  int
+		added int
+		want  []uint64
+	}{
+		{"empty", 3, 0, []uint64{}},
+		{"partly filled", 3, 2, []uint64{1, 2}},
+		{"exactly full", 3, 3, []uint64{1, 2, 3}},
+		{"wrapped once", 3, 4, []uint64{2, 3, 4}},
+		{"wrapped twice", 3, 7, []uint64{5, 6, 7}},
+		{"size one", 1, 5, []uint64{5}},
+		{"history off", 0, 5, []uint64{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newHistoryBuffer(tt.size)
+			for seq := 1; seq <= tt.added; seq++ {
+				h.Add(protocol.Chat{Seq: uint64(seq)})
+			}
+
+			if got := seqs(h.All()); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("All() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHistoryAllIsACopy(t *testing.T) {
+	h := newHistoryBuffer(2)
+	h.Add(protocol.Chat{Seq: 1})
+
+	all := h.All()
+	all[0].Seq = 99
+	h.Add(protocol.Chat{Seq: 2})
+
+	if got := seqs(h.All()); !reflect.DeepEqual(got, []uint64{1, 2}) {
+		t.Errorf("All() = %v after changing an earlier result, want [1 2]", got)
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+// ============================================================
+// KNOCK — ВХОД С ОДОБРЕНИЯ ВЛАДЕЛЬЦА
+// ============================================================
+//
+// В комнате с включённым knock новый участник не попадает внутрь сразу.
+// Сервер пересылает запрос владельцу (клиентам с Owner == true),
+// а сам ждёт ответа: accept — клиент входит, reject или таймаут — отказ.
+
+import (
+	"errors"
+	"time"
+
+	"messenger-protocol"
+)
+
+// knockTimeout — сколько ждать решения владельца
+var knockTimeout = 2 * time.Minute
+
+var (
+	errOwnerOffline   = errors.New("room owner is offline")
+	errAlreadyKnocked = errors.New("a join request with this name is already waiting")
+)
+
+// Knock отправляет запрос владельцу и ждёт решения
+// Возвращает true, если владелец впустил
+func (r *Room) Knock(username string) (bool, error) {
+	r.mu.Lock()
+
+	if _, waiting := r.knocks[username]; waiting {
+		r.mu.Unlock()
+		return false, errAlreadyKnocked
+	}
+
+	f, err := protocol.NewFrame(protocol.TypeKnock, protocol.Knock{Username: username})
+	if err != nil {
+		r.mu.Unlock()
+		return false, err
+	}
+
+	// Отправляем запрос всем подключённым владельцам
+	sent := 0
+	for _, client := range r.Clients {
+		if client.Owner && client.Send(f) == nil {
+			sent++
+		}
+	}
+	if sent == 0 {
+		r.mu.Unlock()
+		return false, errOwnerOffline
+	}
+
+	// Буфер 1 — AnswerKnock не блокируется, даже если мы уже ушли по таймауту
+	decision := make(chan bool, 1)
+	r.knocks[username] = decision
+	r.mu.Unlock()
+
+	defer func() {
+		r.mu.Lock()
+		// Удаляем только свой запрос — под тем же именем мог появиться новый
+		if r.knocks[username] == decision {
+			delete(r.knocks, username)
+		}
+		r.mu.Unlock()
+	}()
+
+	select {
+	case accepted := <-decision:
+		return accepted, nil
+	case <-time.After(knockTimeout):
+		return false, nil
+	case <-stopping:
+		return false, errStopping
+	}
+}
+
+// AnswerKnock передаёт решение владельца ожидающему клиенту
+// Возвращает false, если такого запроса нет
+func (r *Room) AnswerKnock(username string, accept bool) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	decision, ok := r.knocks[username]
+	if !ok {
+		return false
+	}
+
+	delete(r.knocks, username)
+	decision <- accept
+	return true
+}
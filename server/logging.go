@@ -0,0 +1,212 @@
+package main
+
+// ============================================================
+// СТРУКТУРИРОВАННЫЕ ЛОГИ
+// ============================================================
+//
+// Каждое событие — одна строка в формате logfmt или JSON:
+//
+//	time=2024-05-01T12:00:00Z level=info event=room_joined room=r:3fa9c1 user=bob remote_addr=1.2.3.4:5678
+//
+// Флаги:
+//   -log-format=logfmt|json
+//   -log-level=debug|info|warn|error
+//   -log-privacy=true|false
+//
+// Режим приватности (включён по умолчанию):
+//   - поле "body" (текст сообщения, даже зашифрованный) не пишется никогда
+//   - поле "room" заменяется на "r:" + HMAC кода с ключом процесса —
+//     события одной комнаты можно связать между собой, но код не восстановить
+//     (ключ случайный и живёт только в памяти)
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// logLevel — уровень важности события
+type logLevel int
+
+const (
+	levelDebug logLevel = iota
+	levelInfo
+	levelWarn
+	levelError
+)
+
+var levelNames = map[logLevel]string{
+	levelDebug: "debug",
+	levelInfo:  "info",
+	levelWarn:  "warn",
+	levelError: "error",
+}
+
+// parseLevel превращает имя уровня в logLevel
+func parseLevel(name string) (logLevel, error) {
+	for level, n := range levelNames {
+		if n == strings.ToLower(name) {
+			return level, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown log level %q (use debug, info, warn or error)", name)
+}
+
+// eventLogger пишет события построчно в out
+type eventLogger struct {
+	mu      sync.Mutex
+	out     io.Writer
+	json    bool
+	level   logLevel
+	privacy bool
+	roomKey []byte // ключ HMAC для кодов комнат в режиме приватности
+}
+
+// logger — общий логгер сервера. До разбора флагов — logfmt, info, приватный
+var logger = mustLogger(newLogger(os.Stdout, "logfmt", "info", true))
+
+// newLogger создаёт логгер с указанным форматом и уровнем
+func newLogger(out io.Writer, format, level string, privacy bool) (*eventLogger, error) {
+	l := &eventLogger{out: out, privacy: privacy}
+
+	switch format {
+	case "logfmt":
+	case "json":
+		l.json = true
+	default:
+		return nil, fmt.Errorf("unknown log format %q (use logfmt or json)", format)
+	}
+
+	var err error
+	if l.level, err = parseLevel(level); err != nil {
+		return nil, err
+	}
+
+	l.roomKey = make([]byte, 32)
+	if _, err := rand.Read(l.roomKey); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func mustLogger(l *eventLogger, err error) *eventLogger {
+	if err != nil {
+		panic(err)
+	}
+	return l
+}
+
+// Debug, Info, Warn, Error пишут событие с полями key, value, key, value...
+func (l *eventLogger) Debug(event string, kv ...interface{}) { l.log(levelDebug, event, kv) }
+func (l *eventLogger) Info(event string, kv ...interface{})  { l.log(levelInfo, event, kv) }
+func (l *eventLogger) Warn(event string, kv ...interface{})  { l.log(levelWarn, event, kv) }
+func (l *eventLogger) Error(event string, kv ...interface{}) { l.log(levelError, event, kv) }
+
+// logField — одно поле строки лога
+type logField struct {
+	key   string
+	value interface{}
+}
+
+func (l *eventLogger) log(level logLevel, event string, kv []interface{}) {
+	if level < l.level {
+		return
+	}
+
+	fields := []logField{
+		{"time", time.Now().UTC().Format(time.RFC3339)},
+		{"level", levelNames[level]},
+		{"event", event},
+	}
+
+	for i := 0; i+1 < len(kv); i += 2 {
+		key := fmt.Sprint(kv[i])
+		value := kv[i+1]
+
+		if l.privacy {
+			switch key {
+			case "body":
+				continue
+			case "room":
+				value = l.redactRoom(fmt.Sprint(value))
+			}
+		}
+
+		switch v := value.(type) {
+		case error:
+			value = v.Error()
+		case time.Duration:
+			value = v.String()
+		}
+		fields = append(fields, logField{key, value})
+	}
+
+	var line string
+	if l.json {
+		line = encodeJSON(fields)
+	} else {
+		line = encodeLogfmt(fields)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	io.WriteString(l.out, line+"\n")
+}
+
+// redactRoom заменяет код комнаты на короткий HMAC
+func (l *eventLogger) redactRoom(code string) string {
+	if code == "" {
+		return ""
+	}
+	mac := hmac.New(sha256.New, l.roomKey)
+	mac.Write([]byte(code))
+	return "r:" + hex.EncodeToString(mac.Sum(nil)[:3])
+}
+
+// encodeJSON — поля в том же порядке, в каком их передали
+func encodeJSON(fields []logField) string {
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, f := range fields {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		key, _ := json.Marshal(f.key)
+		value, err := json.Marshal(f.value)
+		if err != nil {
+			value, _ = json.Marshal(fmt.Sprint(f.value))
+		}
+		b.Write(key)
+		b.WriteByte(':')
+		b.Write(value)
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// encodeLogfmt — key=value, значения с пробелами и кавычками экранируются
+func encodeLogfmt(fields []logField) string {
+	var b strings.Builder
+	for i, f := range fields {
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		value := fmt.Sprint(f.value)
+		if value == "" || strings.ContainsAny(value, " =\"\\\t\r\n") {
+			value = strconv.Quote(value)
+		}
+		b.WriteString(f.key)
+		b.WriteByte('=')
+		b.WriteString(value)
+	}
+	return b.String()
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// parseLogfmt разбирает строку logfmt обратно в поля
+// (значения в кавычках — как их пишет strconv.Quote)
+func parseLogfmt(t *testing.T, line string) map[string]string {
+	t.Helper()
+
+	fields := make(map[string]string)
+	for line != "" {
+		eq := strings.IndexByte(line, '=')
+		if eq <= 0 || strings.ContainsAny(line[:eq], " \"") {
+			t.Fatalf("no key=value at %q", line)
+		}
+		key := line[:eq]
+		line = line[eq+1:]
+
+		var value string
+		if strings.HasPrefix(line, `"`) {
+			quoted, err := strconv.QuotedPrefix(line)
+			if err != nil {
+				t.Fatalf("bad quoted value at %q: %v", line, err)
+			}
+			value, _ = strconv.Unquote(quoted)
+			line = line[len(quoted):]
+		} else {
+			end := strings.IndexByte(line, ' ')
+			if end < 0 {
+				end = len(line)
+			}
+			value = line[:end]
+			line = line[end:]
+		}
+
+		if _, ok := fields[key]; ok {
+			t.Fatalf("key %q twice", key)
+		}
+		fields[key] = value
+		if line != "" && !strings.HasPrefix(line, " ") {
+			t.Fatalf("no space after %s=%q", key, value)
+		}
+		line = strings.TrimPrefix(line, " ")
+	}
+	return fields
+}
+
+// logLines пишет события логгером и возвращает весь текст
+// и каждую строку, разобранную в поля
+func logLines(t *testing.T, format string, privacy bool, write func(l *eventLogger)) (string, []map[string]string) {
+	t.Helper()
+
+	var out bytes.Buffer
+	l := mustLogger(newLogger(&out, format, "debug", privacy))
+	write(l)
+
+	var lines []map[string]string
+	for _, line := range strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n") {
+		if format == "logfmt" {
+			lines = append(lines, parseLogfmt(t, line))
+			continue
+		}
+
+		var values map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &values); err != nil {
+			t.Fatalf("not a JSON object: %s: %v", line, err)
+		}
+		fields := make(map[string]string)
+		for k, v := range values {
+			fields[k] = fmt.Sprint(v)
+		}
+		lines = append(lines, fields)
+	}
+	return out.String(), lines
+}
+
+func TestLogPrivacy(t *testing.T) {
+	const body = "c2VjcmV0IG1lc3NhZ2U="
+
+	for _, format := range []string{"logfmt", "json"} {
+		t.Run(format, func(t *testing.T) {
+			var tag string
+			text, lines := logLines(t, format, true, func(l *eventLogger) {
+				l.Debug("message_relayed", "room", "12345678", "user", "bob", "bytes", len(body), "body", body)
+				l.Info("room_joined", "room", "12345678", "user", "alice")
+				l.Info("room_joined", "room", "87654321", "user", "carol")
+				l.Warn("join_failed", "room", "", "user", "dave")
+				tag = l.redactRoom("12345678")
+			})
+
+			for _, secret := range []string{body, "12345678", "87654321"} {
+				if strings.Contains(text, secret) {
+					t.Errorf("%q leaked into the log:\n%s", secret, text)
+				}
+			}
+			if _, ok := lines[0]["body"]; ok {
+				t.Error("body field written in privacy mode")
+			}
+			if lines[0]["bytes"] != strconv.Itoa(len(body)) {
+				t.Errorf("bytes = %q, want %d", lines[0]["bytes"], len(body))
+			}
+
+			// Одна комната — один и тот же тег, разные комнаты — разные
+			if !strings.HasPrefix(tag, "r:") || len(tag) != len("r:")+6 {
+				t.Errorf("room tag %q is not r: and 6 hex digits", tag)
+			}
+			if lines[0]["room"] != tag || lines[1]["room"] != tag {
+				t.Errorf("room = %q and %q, want %q in both", lines[0]["room"], lines[1]["room"], tag)
+			}
+			if lines[2]["room"] == tag {
+				t.Error("two rooms got the same tag")
+			}
+			if lines[3]["room"] != "" {
+				t.Errorf("empty room logged as %q", lines[3]["room"])
+			}
+		})
+	}
+}
+
+func TestLogPrivacyOff(t *testing.T) {
+	_, lines := logLines(t, "logfmt", false, func(l *eventLogger) {
+		l.Debug("message_relayed", "room", "12345678", "body", "hello")
+	})
+	if lines[0]["room"] != "12345678" || lines[0]["body"] != "hello" {
+		t.Errorf("got room=%q body=%q, want the real values", lines[0]["room"], lines[0]["body"])
+	}
+}
+
+func TestLogWellFormed(t *testing.T) {
+	// Значения, которые ломают наивную запись
+	awkward := []interface{}{
+		"user", `bob "the" builder`,
+		"reason", "line one\nline two",
+		"path", `C:\rooms\file.json`,
+		"empty", "",
+		"equals", "a=b",
+		"unicode", "Привет",
+		"error", errors.New("read tcp: connection reset"),
+		"timeout", 90 * time.Second,
+		"count", 3,
+		"ok", true,
+		"odd", // ключ без значения пропускается
+	}
+	want := map[string]string{
+		"level":   "info",
+		"event":   "odd_values",
+		"user":    `bob "the" builder`,
+		"reason":  "line one\nline two",
+		"path":    `C:\rooms\file.json`,
+		"empty":   "",
+		"equals":  "a=b",
+		"unicode": "Привет",
+		"error":   "read tcp: connection reset",
+		"timeout": "1m30s",
+		"count":   "3",
+		"ok":      "true",
+	}
+
+	for _, format := range []string{"logfmt", "json"} {
+		t.Run(format, func(t *testing.T) {
+			// Перевод строки в значении не рвёт строку лога
+			text, lines := logLines(t, format, true, func(l *eventLogger) {
+				l.Info("odd_values", awkward...)
+				l.Info("second")
+			})
+			if n := strings.Count(text, "\n"); n != 2 {
+				t.Fatalf("%d lines for 2 events:\n%s", n, text)
+			}
+
+			got := lines[0]
+			if _, err := time.Parse(time.RFC3339, got["time"]); err != nil {
+				t.Errorf("time = %q: %v", got["time"], err)
+			}
+			delete(got, "time")
+			if len(got) != len(want) {
+				t.Errorf("fields = %v, want %v", got, want)
+			}
+			for key, value := range want {
+				if got[key] != value {
+					t.Errorf("%s = %q, want %q", key, got[key], value)
+				}
+			}
+		})
+	}
+}
+
+func TestLogLevel(t *testing.T) {
+	var out bytes.Buffer
+	l := mustLogger(newLogger(&out, "logfmt", "warn", true))
+
+	l.Debug("debug_event")
+	l.Info("info_event")
+	l.Warn("warn_event")
+	l.Error("error_event")
+
+	if got := out.String(); strings.Contains(got, "debug_event") || strings.Contains(got, "info_event") ||
+		!strings.Contains(got, "warn_event") || !strings.Contains(got, "error_event") {
+		t.Errorf("level warn wrote:\n%s", got)
+	}
+}
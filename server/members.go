@@ -0,0 +1,176 @@
+package main
+
+// ============================================================
+// УЧАСТНИКИ ПОСТОЯННЫХ КОМНАТ И ОФЛАЙН-ОЧЕРЕДЬ
+// ============================================================
+//
+// Постоянная комната запоминает всех, кто в неё заходил (по username).
+// Пока участник не в сети, его сообщения копятся в личной очереди
+// (только шифротекст), а при возвращении отправляются ему сразу
+// после ack — вместо общей истории.
+//
+// Одного имени для этого мало: кто угодно может войти под чужим.
+// Поэтому новый участник получает в ack токен участника (member token),
+// а сервер хранит только его SHA-256. Очередь отдаётся только тому,
+// кто предъявил токен в join; без токена под известным именем входят
+// как гость — с общей историей, а очередь ждёт настоящего участника.
+//
+// Очередь ограничена по размеру и по возрасту: лишнее и старое
+// выбрасывается, а клиенту сообщается сколько пропало.
+//
+// Очереди живут только в памяти: в файл (filestore.go) сообщения не
+// пишутся, и перезапуск сервера их теряет. Участник, загруженный из
+// файла, узнаёт об этом при первом входе.
+
+import (
+	"time"
+
+	"messenger-protocol"
+)
+
+// Лимиты офлайн-очереди (меняются флагами -queue-size и -queue-age)
+var (
+	memberQueueSize = 100
+	memberQueueAge  = 24 * time.Hour
+)
+
+// member — известный участник постоянной комнаты
+type member struct {
+	Username  string
+	tokenHash string       // SHA-256 токена участника (secret.go)
+	queue     []queuedChat // сообщения, пришедшие пока участник офлайн
+	dropped   int          // сколько сообщений выброшено из-за лимитов
+	restored  bool         // загружен из файла: очередь до перезапуска потеряна
+}
+
+type queuedChat struct {
+	chat protocol.Chat
+	at   time.Time
+}
+
+// enqueue кладёт сообщение в очередь, вытесняя самое старое
+func (m *member) enqueue(chat protocol.Chat, now time.Time) {
+	if memberQueueSize <= 0 {
+		m.dropped++
+		return
+	}
+
+	m.prune(now)
+	if len(m.queue) >= memberQueueSize {
+		m.queue = m.queue[1:]
+		m.dropped++
+	}
+	m.queue = append(m.queue, queuedChat{chat: chat, at: now})
+}
+
+// prune выбрасывает сообщения старше memberQueueAge
+func (m *member) prune(now time.Time) {
+	cut := 0
+	for cut < len(m.queue) && now.Sub(m.queue[cut].at) > memberQueueAge {
+		cut++
+	}
+	m.queue = m.queue[cut:]
+	m.dropped += cut
+}
+
+// take забирает всю очередь (от старых к новым) и обнуляет её
+func (m *member) take(now time.Time) ([]protocol.Chat, int) {
+	m.prune(now)
+
+	chats := make([]protocol.Chat, 0, len(m.queue))
+	for _, q := range m.queue {
+		chats = append(chats, q.chat)
+	}
+	dropped := m.dropped
+
+	m.queue = nil
+	m.dropped = 0
+	return chats, dropped
+}
+
+// ============================================================
+// МЕТОДЫ КОМНАТЫ (вызываются под r.mu)
+// ============================================================
+
+// admitMember сверяет client с участниками комнаты (под r.mu)
+//
+// Возвращает участника, чью офлайн-очередь client должен получить
+// (nil — нечего отдавать), и новый токен, если client только что стал
+// участником (тогда комнату стоит сохранить в store). Участникам
+// ставится client.Member.
+func (r *Room) admitMember(client *Client) (*member, string, error) {
+	m, known := r.members[client.Username]
+	if known && m.tokenHash != "" {
+		if !checkToken(client.MemberToken, m.tokenHash) {
+			return nil, "", nil // гость под именем участника
+		}
+		client.Member = true
+		return m, "", nil
+	}
+
+	token, err := newToken()
+	if err != nil {
+		return nil, "", err
+	}
+	client.Member = true
+
+	// Участник из файла, записанного до появления токенов: токен
+	// получает первый, кто вернётся под этим именем
+	if known {
+		m.tokenHash = hashToken(token)
+		return m, token, nil
+	}
+
+	r.members[client.Username] = &member{Username: client.Username, tokenHash: hashToken(token)}
+	return nil, token, nil
+}
+
+// enqueueOffline кладёт сообщение в очереди всех участников не в сети
+//
+// Гость под именем участника участником не считается: пока он в
+// комнате, очередь настоящего участника продолжает копиться.
+func (r *Room) enqueueOffline(chat protocol.Chat) {
+	if len(r.members) == 0 {
+		return
+	}
+
+	online := make(map[string]bool, len(r.Clients))
+	for _, client := range r.Clients {
+		if client.Member {
+			online[client.Username] = true
+		}
+	}
+
+	now := time.Now()
+	for name, m := range r.members {
+		if !online[name] {
+			m.enqueue(chat, now)
+		}
+	}
+}
+
+// MemberNames возвращает имена всех известных участников
+func (r *Room) MemberNames() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	names := make([]string, 0, len(r.members))
+	for name := range r.members {
+		names = append(names, name)
+	}
+	return names
+}
+
+// MemberTokens возвращает хеши токенов участников по именам
+func (r *Room) MemberTokens() map[string]string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	tokens := make(map[string]string, len(r.members))
+	for name, m := range r.members {
+		if m.tokenHash != "" {
+			tokens[name] = m.tokenHash
+		}
+	}
+	return tokens
+}
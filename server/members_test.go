@@ -0,0 +1,157 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"messenger-protocol"
+)
+
+// withQueueLimits подменяет лимиты офлайн-очереди на время теста
+func withQueueLimits(t *testing.T, size int, age time.Duration) {
+	oldSize, oldAge := memberQueueSize, memberQueueAge
+	memberQueueSize, memberQueueAge = size, age
+	t.Cleanup(func() { memberQueueSize, memberQueueAge = oldSize, oldAge })
+}
+
+func TestMemberQueueLimits(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+
+	tests := []struct {
+		name        string
+		size        int
+		age         time.Duration
+		sent        []time.Duration // когда пришло каждое сообщение (от start)
+		takenAt     time.Duration
+		want        []uint64
+		wantDropped int
+	}{
+		{"empty", 3, time.Hour, nil, 0, []uint64{}, 0},
+		{"under the limit", 3, time.Hour, []time.Duration{0, 1, 2}, 3, []uint64{1, 2, 3}, 0},
+		{"oldest pushed out", 3, time.Hour, []time.Duration{0, 1, 2, 3, 4}, 5, []uint64{3, 4, 5}, 2},
+		{"expired by take", 3, time.Hour, []time.Duration{0, time.Minute}, time.Hour + 30*time.Second, []uint64{2}, 1},
+		{"expired by enqueue", 5, time.Hour, []time.Duration{0, 2 * time.Hour}, 2 * time.Hour, []uint64{2}, 1},
+		{"exactly at the age limit", 3, time.Hour, []time.Duration{0}, time.Hour, []uint64{1}, 0},
+		{"all expired", 3, time.Hour, []time.Duration{0, 1}, 3 * time.Hour, []uint64{}, 2},
+		{"queue off", 0, time.Hour, []time.Duration{0, 1, 2}, 3, []uint64{}, 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withQueueLimits(t, tt.size, tt.age)
+
+			m := &member{Username: "bob"}
+			for i, at := range tt.sent {
+				m.enqueue(protocol.Chat{Seq: uint64(i + 1)}, start.Add(at))
+			}
+
+			chats, dropped := m.take(start.Add(tt.takenAt))
+			if got := seqs(chats); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("take() = %v, want %v", got, tt.want)
+			}
+			if dropped != tt.wantDropped {
+				t.Errorf("dropped = %d, want %d", dropped, tt.wantDropped)
+			}
+
+			// Очередь отдаётся один раз
+			if chats, dropped := m.take(start.Add(tt.takenAt)); len(chats) != 0 || dropped != 0 {
+				t.Errorf("second take() = %d chats, %d dropped, want nothing", len(chats), dropped)
+			}
+		})
+	}
+}
+
+func TestAdmitMember(t *testing.T) {
+	room := NewRoom("12345678", "alice", RoomSettings{Persistent: true})
+	room.members["carol"] = &member{Username: "carol"} // из файла без токенов
+
+	// Первый вход — новый участник с токеном
+	bob := &Client{Username: "bob"}
+	m, token, err := room.admitMember(bob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m != nil || token == "" || !bob.Member {
+		t.Fatalf("new member: got member %v, token %q, Member %v", m, token, bob.Member)
+	}
+	room.members["bob"].enqueue(protocol.Chat{Seq: 1}, time.Now())
+
+	tests := []struct {
+		name       string
+		username   string
+		token      string
+		wantQueue  bool // получает офлайн-очередь
+		wantToken  bool // получает новый токен
+		wantMember bool
+	}{
+		{"no token", "bob", "", false, false, false},
+		{"wrong token", "bob", "0123456789abcdef0123456789abcdef", false, false, false},
+		{"right token", "bob", token, true, false, true},
+		{"member without token yet", "carol", "", true, true, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &Client{Username: tt.username, MemberToken: tt.token}
+			m, newToken, err := room.admitMember(client)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (m != nil) != tt.wantQueue {
+				t.Errorf("queue given = %v, want %v", m != nil, tt.wantQueue)
+			}
+			if (newToken != "") != tt.wantToken {
+				t.Errorf("new token = %q, want one: %v", newToken, tt.wantToken)
+			}
+			if client.Member != tt.wantMember {
+				t.Errorf("Member = %v, want %v", client.Member, tt.wantMember)
+			}
+		})
+	}
+
+	// Гость под именем участника не считается участником в сети:
+	// очередь настоящего участника продолжает копиться
+	m, _, _ = room.admitMember(&Client{Username: "bob", MemberToken: token})
+	m.take(time.Now())
+	room.Clients = append(room.Clients, &Client{Username: "bob"})
+	room.enqueueOffline(protocol.Chat{Seq: 2})
+	if chats, _ := m.take(time.Now()); !reflect.DeepEqual(seqs(chats), []uint64{2}) {
+		t.Errorf("queue with a guest online = %v, want [2]", seqs(chats))
+	}
+}
+
+func TestRestoredMemberTold(t *testing.T) {
+	quietLogger(t)
+
+	// Участник загружен из файла: очередь до перезапуска потеряна
+	token := "0123456789abcdef0123456789abcdef"
+	room := NewRoom("12345678", "alice", RoomSettings{Persistent: true})
+	room.members["bob"] = &member{Username: "bob", tokenHash: hashToken(token), restored: true}
+
+	notices := func() int {
+		client := newTestClient(t)
+		client.MemberToken = token
+		if _, err := room.Join(client, protocol.Ack{}); err != nil {
+			t.Fatal(err)
+		}
+		room.RemoveClient(client)
+
+		count := 0
+		for len(client.queue) > 0 {
+			f := <-client.queue
+			var sys protocol.System
+			if f.Type == protocol.TypeSystem && f.Decode(&sys) == nil && sys.Event == protocol.EventNotice {
+				count++
+			}
+		}
+		return count
+	}
+
+	if got := notices(); got != 1 {
+		t.Errorf("first join after the restart: %d notices, want 1", got)
+	}
+	if got := notices(); got != 0 {
+		t.Errorf("second join: %d notices, want 0", got)
+	}
+}
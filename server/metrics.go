@@ -0,0 +1,236 @@
+package main
+
+// ============================================================
+// МЕТРИКИ В ФОРМАТЕ PROMETHEUS
+// ============================================================
+//
+// Флаг -metrics=:9100 включает HTTP-эндпоинт /metrics.
+// Счётчики растут всегда (скорость "в секунду" считает Prometheus
+// через rate()), gauge показывает текущее значение.
+//
+// Всё написано на стандартной библиотеке — формат простой:
+//
+//	# HELP name описание
+//	# TYPE name counter
+//	name 42
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// metric — всё, что умеет записать себя в формате Prometheus
+type metric interface {
+	writeTo(w io.Writer)
+}
+
+// registry — все метрики в порядке регистрации
+var registry []metric
+
+// ============================================================
+// СПИСОК МЕТРИК
+// ============================================================
+
+var (
+	metricConnections = newGauge("messenger_connections_active",
+		"Currently open client connections")
+	metricRooms = newGaugeFunc("messenger_rooms_active",
+		"Rooms currently known to the server", func() float64 { return float64(store.Count()) })
+	metricRoomsCreated = newCounter("messenger_rooms_created_total",
+		"Rooms created")
+	metricRoomsDeleted = newCounter("messenger_rooms_deleted_total",
+		"Rooms deleted")
+	metricJoins = newCounter("messenger_joins_total",
+		"Clients that entered a room (create or join)")
+	metricLeaves = newCounter("messenger_leaves_total",
+		"Clients that left a room")
+	metricFailedJoins = newCounter("messenger_failed_joins_total",
+		"Join attempts rejected for an unknown room code or wrong password")
+	metricThrottledJoins = newCounterFunc("messenger_throttled_joins_total",
+		"Join attempts rejected by brute-force protection", func() float64 { return float64(guard.Stats().Throttled) })
+	metricBans = newCounterFunc("messenger_join_bans_total",
+		"Addresses temporarily banned for failed joins", func() float64 { return float64(guard.Stats().Bans) })
+	metricMessages = newCounter("messenger_messages_relayed_total",
+		"Chat messages relayed to a room")
+	metricDirect = newCounter("messenger_direct_messages_total",
+		"Private messages relayed to one member")
+	metricBytes = newCounter("messenger_bytes_relayed_total",
+		"Bytes written to clients")
+	metricWriteErrors = newCounter("messenger_write_errors_total",
+		"Failed or timed out writes to a client")
+	metricSlowConsumers = newCounter("messenger_slow_consumers_total",
+		"Clients disconnected because their send queue overflowed")
+	metricRateLimited = newCounter("messenger_rate_limited_messages_total",
+		"Chat and private messages dropped by the per-client message/byte limits")
+	metricFloodKicks = newCounter("messenger_flood_disconnects_total",
+		"Clients disconnected for flooding")
+	metricRejectedConns = newCounterFunc("messenger_rejected_connections_total",
+		"Connections refused by the per-address connection limit", func() float64 { c, _ := limiter.Stats(); return float64(c) })
+	metricRejectedCreates = newCounterFunc("messenger_rejected_creates_total",
+		"Room creations refused by the per-address rate limit", func() float64 { _, c := limiter.Stats(); return float64(c) })
+	metricBroadcastLatency = newHistogram("messenger_broadcast_duration_seconds",
+		"Time to queue one frame for every client in a room",
+		[]float64{0.0001, 0.0005, 0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5})
+)
+
+// metricsHeaderTimeout — сколько ждать заголовков запроса к /metrics
+// (как wsHeaderTimeout: иначе медленный клиент держит соединение вечно)
+const metricsHeaderTimeout = 10 * time.Second
+
+// serveMetrics запускает HTTP-сервер с /metrics
+func serveMetrics(addr string) error {
+	return newMetricsServer(addr).ListenAndServe()
+}
+
+// newMetricsServer — HTTP-сервер, который отдаёт все метрики из registry
+func newMetricsServer(addr string) *http.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		for _, m := range registry {
+			m.writeTo(w)
+		}
+	})
+
+	return &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: metricsHeaderTimeout,
+	}
+}
+
+// ============================================================
+// COUNTER И GAUGE
+// ============================================================
+
+type counter struct {
+	name, help string
+	value      int64
+}
+
+func newCounter(name, help string) *counter {
+	c := &counter{name: name, help: help}
+	registry = append(registry, c)
+	return c
+}
+
+func (c *counter) Inc()        { atomic.AddInt64(&c.value, 1) }
+func (c *counter) Add(n int64) { atomic.AddInt64(&c.value, n) }
+
+func (c *counter) writeTo(w io.Writer) {
+	writeHeader(w, c.name, c.help, "counter")
+	fmt.Fprintf(w, "%s %d\n", c.name, atomic.LoadInt64(&c.value))
+}
+
+type gauge struct {
+	name, help string
+	value      int64
+}
+
+func newGauge(name, help string) *gauge {
+	g := &gauge{name: name, help: help}
+	registry = append(registry, g)
+	return g
+}
+
+func (g *gauge) Inc() { atomic.AddInt64(&g.value, 1) }
+func (g *gauge) Dec() { atomic.AddInt64(&g.value, -1) }
+
+func (g *gauge) writeTo(w io.Writer) {
+	writeHeader(w, g.name, g.help, "gauge")
+	fmt.Fprintf(w, "%s %d\n", g.name, atomic.LoadInt64(&g.value))
+}
+
+// funcMetric — значение берётся из функции в момент запроса
+type funcMetric struct {
+	name, help, kind string
+	fn               func() float64
+}
+
+func newGaugeFunc(name, help string, fn func() float64) *funcMetric {
+	m := &funcMetric{name: name, help: help, kind: "gauge", fn: fn}
+	registry = append(registry, m)
+	return m
+}
+
+func newCounterFunc(name, help string, fn func() float64) *funcMetric {
+	m := &funcMetric{name: name, help: help, kind: "counter", fn: fn}
+	registry = append(registry, m)
+	return m
+}
+
+func (m *funcMetric) writeTo(w io.Writer) {
+	writeHeader(w, m.name, m.help, m.kind)
+	fmt.Fprintf(w, "%s %s\n", m.name, formatFloat(m.fn()))
+}
+
+// ============================================================
+// HISTOGRAM
+// ============================================================
+
+type histogram struct {
+	name, help string
+	buckets    []float64 // верхние границы, по возрастанию
+
+	mu     sync.Mutex
+	counts []uint64 // counts[i] — наблюдений <= buckets[i] (не накопительно)
+	sum    float64
+	count  uint64
+}
+
+func newHistogram(name, help string, buckets []float64) *histogram {
+	h := &histogram{name: name, help: help, buckets: buckets, counts: make([]uint64, len(buckets))}
+	registry = append(registry, h)
+	return h
+}
+
+// Observe добавляет одно наблюдение
+func (h *histogram) Observe(v float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for i, upper := range h.buckets {
+		if v <= upper {
+			h.counts[i]++
+			break
+		}
+	}
+	h.sum += v
+	h.count++
+}
+
+// ObserveSince — удобно для замера длительности
+func (h *histogram) ObserveSince(start time.Time) {
+	h.Observe(time.Since(start).Seconds())
+}
+
+func (h *histogram) writeTo(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	writeHeader(w, h.name, h.help, "histogram")
+
+	// В Prometheus бакеты накопительные: le="0.01" включает все меньшие
+	var cumulative uint64
+	for i, upper := range h.buckets {
+		cumulative += h.counts[i]
+		fmt.Fprintf(w, "%s_bucket{le=\"%s\"} %d\n", h.name, formatFloat(upper), cumulative)
+	}
+	fmt.Fprintf(w, "%s_bucket{le=\"+Inf\"} %d\n", h.name, h.count)
+	fmt.Fprintf(w, "%s_sum %s\n", h.name, formatFloat(h.sum))
+	fmt.Fprintf(w, "%s_count %d\n", h.name, h.count)
+}
+
+func writeHeader(w io.Writer, name, help, kind string) {
+	fmt.Fprintf(w, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(w, "# TYPE %s %s\n", name, kind)
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMetricsServer(t *testing.T) {
+	srv := newMetricsServer("127.0.0.1:9100")
+
+	// Без таймаута заголовков медленный клиент держит соединение вечно
+	if srv.ReadHeaderTimeout <= 0 {
+		t.Error("metrics server has no ReadHeaderTimeout")
+	}
+
+	rec := httptest.NewRecorder()
+	srv.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /metrics = %d", rec.Code)
+	}
+	if body := rec.Body.String(); !strings.Contains(body, "messenger_flood_disconnects_total") {
+		t.Errorf("metrics output has no messenger_flood_disconnects_total:\n%s", body)
+	}
+}
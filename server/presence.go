@@ -0,0 +1,82 @@
+package main
+
+// ============================================================
+// КТО В КОМНАТЕ (WHO)
+// ============================================================
+//
+// Клиент с возможностью "who" может в любой момент спросить список
+// участников: имя, владелец ли, когда вошёл, сколько молчит.
+// Кто молчит дольше -away-after, помечается как "away".
+// Список строится из Room.Clients — только те, кто сейчас подключён.
+//
+// Чтобы ответ всегда помещался во фрейм, в нём не больше
+// protocol.MaxWhoMembers участников (и тогда total — сколько их всего).
+// Клиент может спросить и про одного участника по имени — так /msg
+// находит ключ получателя в любой комнате.
+
+import (
+	"strings"
+	"time"
+
+	"messenger-protocol"
+)
+
+// awayAfter — после скольких минут молчания участник "away" (флаг -away-after)
+var awayAfter = 5 * time.Minute
+
+// Members возвращает список подключённых участников
+func (r *Room) Members() []protocol.Member {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	members := make([]protocol.Member, 0, len(r.Clients))
+	for _, c := range r.Clients {
+		idle := now.Sub(c.LastActive)
+		members = append(members, protocol.Member{
+			Username:  c.Username,
+			Owner:     c.Owner,
+			JoinedAt:  c.JoinedAt.Unix(),
+			Idle:      int64(idle.Seconds()),
+			Away:      idle >= awayAfter,
+			PublicKey: c.PublicKey,
+		})
+	}
+	return members
+}
+
+// answerWho отправляет клиенту список участников комнаты
+// (или одного участника, если в запросе есть имя)
+func answerWho(client *Client, room *Room, frame protocol.Frame) {
+	var req protocol.Who
+	if err := frame.Decode(&req); err != nil {
+		client.Send(errorFrame(protocol.ErrBadRequest, "Invalid who request"))
+		return
+	}
+	if err := req.CheckLimits(); err != nil {
+		client.Send(errorFrame(protocol.ErrFieldTooLong, err.Error()))
+		return
+	}
+
+	members := room.Members()
+	if req.Username != "" {
+		found := members[:0]
+		for _, m := range members {
+			if strings.EqualFold(m.Username, req.Username) {
+				found = append(found, m)
+			}
+		}
+		members = found
+	}
+
+	who := protocol.Who{Members: members}
+	if len(members) > protocol.MaxWhoMembers {
+		who.Members = members[:protocol.MaxWhoMembers]
+		who.Total = len(members)
+	}
+
+	f, err := protocol.NewFrame(protocol.TypeWho, who)
+	if err == nil {
+		client.Send(f)
+	}
+}
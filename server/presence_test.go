@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"messenger-protocol"
+)
+
+// whoAnswer — ответ на запрос req от клиента в комнате с count участниками
+func whoAnswer(t *testing.T, count int, req protocol.Who) protocol.Who {
+	room := NewRoom("12345678", "alice", RoomSettings{})
+	for i := 0; i < count; i++ {
+		room.Clients = append(room.Clients, &Client{Username: fmt.Sprintf("user%d", i), JoinedAt: time.Now()})
+	}
+
+	client := newTestClient(t)
+	request, err := protocol.NewFrame(protocol.TypeWho, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	answerWho(client, room, request)
+
+	f := <-client.queue
+	var who protocol.Who
+	if f.Type != protocol.TypeWho {
+		t.Fatalf("got a %s frame, want who", f.Type)
+	}
+	if err := f.Decode(&who); err != nil {
+		t.Fatal(err)
+	}
+	return who
+}
+
+func TestAnswerWho(t *testing.T) {
+	tests := []struct {
+		name      string
+		count     int
+		req       protocol.Who
+		wantCount int
+		wantTotal int
+	}{
+		{"small room", 3, protocol.Who{}, 3, 0},
+		{"exactly at the cap", protocol.MaxWhoMembers, protocol.Who{}, protocol.MaxWhoMembers, 0},
+		{"over the cap", protocol.MaxWhoMembers + 50, protocol.Who{}, protocol.MaxWhoMembers, protocol.MaxWhoMembers + 50},
+		{"one member", protocol.MaxWhoMembers + 50, protocol.Who{Username: "USER120"}, 1, 0},
+		{"member not here", 3, protocol.Who{Username: "bob"}, 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			who := whoAnswer(t, tt.count, tt.req)
+			if len(who.Members) != tt.wantCount || who.Total != tt.wantTotal {
+				t.Errorf("got %d members, total %d; want %d, %d", len(who.Members), who.Total, tt.wantCount, tt.wantTotal)
+			}
+			if tt.req.Username != "" && len(who.Members) == 1 && who.Members[0].Username != "user120" {
+				t.Errorf("got %q, want user120", who.Members[0].Username)
+			}
+		})
+	}
+}
+
+func TestWhoAnswerFitsInFrame(t *testing.T) {
+	// Самые длинные имена и ключи — ответ всё равно помещается во фрейм
+	room := NewRoom("12345678", "alice", RoomSettings{})
+	for i := 0; i < protocol.MaxWhoMembers; i++ {
+		name := fmt.Sprintf("%03d", i)
+		for len(name)+4 <= protocol.MaxUsernameLength {
+			name += "ж"
+		}
+		room.Clients = append(room.Clients, &Client{
+			Username:  name,
+			Owner:     true,
+			PublicKey: fmt.Sprintf("%0*d", protocol.MaxPublicKeyLength, i),
+			JoinedAt:  time.Now(),
+		})
+	}
+
+	f, err := protocol.NewFrame(protocol.TypeWho, protocol.Who{Members: room.Members(), Total: 1 << 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(f.Payload) > protocol.PayloadLimit(protocol.TypeWho) {
+		t.Errorf("largest who answer is %d bytes, limit %d", len(f.Payload), protocol.PayloadLimit(protocol.TypeWho))
+	}
+	if perMember := len(f.Payload) / protocol.MaxWhoMembers; perMember > 400 {
+		t.Errorf("%d bytes per member, more than the documented ~400", perMember)
+	}
+}
@@ -0,0 +1,276 @@
+package main
+
+// ============================================================
+// ОГРАНИЧЕНИЕ СКОРОСТИ И ЗАЩИТА ОТ ФЛУДА
+// ============================================================
+//
+// Все лимиты — "ведро токенов" (token bucket): ведро наполняется
+// со скоростью rate токенов в секунду, но не больше burst. Каждое
+// действие забирает токены; если их не хватает — действие отклоняется,
+// а клиент узнаёт, сколько подождать (retry_after).
+//
+//   - сообщения и байты — на каждого клиента (-msg-rate, -byte-rate)
+//   - создание комнат — на IP (-create-rate, в минуту)
+//   - одновременные соединения — на IP (-max-conns-per-ip)
+//
+// Первое отклонённое сообщение подряд получает ошибку rate_limited,
+// остальные молча отбрасываются — чтобы ответы не стали вторым флудом.
+// После -flood-kick отклонённых сообщений подряд клиент отключается.
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"messenger-protocol"
+)
+
+// Настройки (флаги -msg-rate, -msg-burst, ...). 0 в rate — без лимита.
+var (
+	messageRate   = 5.0         // сообщений в секунду на клиента
+	messageBurst  = 20          // сообщений подряд без паузы
+	byteRate      = 64.0 * 1024 // байт шифротекста в секунду на клиента
+	byteBurst     = 256 * 1024  // байт подряд без паузы
+	createRate    = 6.0         // комнат в минуту на IP
+	createBurst   = 3           // комнат подряд без паузы
+	maxConnsPerIP = 20          // одновременных соединений с одного IP
+	floodKick     = 100         // отклонённых сообщений подряд до отключения
+)
+
+// tokenBucket — одно ведро токенов; nil — лимита нет
+type tokenBucket struct {
+	rate   float64 // токенов в секунду
+	burst  float64 // вместимость
+	tokens float64
+	last   time.Time
+}
+
+// newBucket создаёт полное ведро (rate <= 0 — без лимита, nil)
+func newBucket(rate float64, burst int) *tokenBucket {
+	if rate <= 0 {
+		return nil
+	}
+	return &tokenBucket{rate: rate, burst: float64(burst), tokens: float64(burst), last: time.Now()}
+}
+
+// refill доливает токены за время, прошедшее с прошлого раза
+func (b *tokenBucket) refill(now time.Time) {
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+}
+
+// wait — сколько ждать, пока в ведре наберётся n токенов (0 — уже есть)
+func (b *tokenBucket) wait(n float64, now time.Time) time.Duration {
+	if b == nil {
+		return 0
+	}
+	b.refill(now)
+	if b.tokens >= n {
+		return 0
+	}
+	return time.Duration((n - b.tokens) / b.rate * float64(time.Second))
+}
+
+// take забирает n токенов (сначала проверьте wait)
+func (b *tokenBucket) take(n float64) {
+	if b != nil {
+		b.tokens -= n
+	}
+}
+
+// full — ведро полное, его можно забыть
+func (b *tokenBucket) full(now time.Time) bool {
+	b.refill(now)
+	return b.tokens >= b.burst
+}
+
+// ============================================================
+// ЛИМИТЫ КЛИЕНТА
+// ============================================================
+
+// clientLimits — лимиты одного клиента. Используются только
+// горутиной handleClient этого клиента, мьютекс не нужен.
+type clientLimits struct {
+	messages *tokenBucket
+	bytes    *tokenBucket
+	typing   *tokenBucket // события typing (typing.go)
+	rejected int          // отклонено сообщений подряд
+}
+
+func newClientLimits() clientLimits {
+	return clientLimits{
+		messages: newBucket(messageRate, messageBurst),
+		bytes:    newBucket(byteRate, byteBurst),
+		typing:   newBucket(typingRate, typingBurst),
+	}
+}
+
+// allowMessage проверяет лимиты для сообщения размером size байт
+// Если нельзя — возвращает сколько подождать
+func (l *clientLimits) allowMessage(size int) (bool, time.Duration) {
+	now := time.Now()
+
+	// Забираем токены, только если хватает в обоих вёдрах
+	wait := l.messages.wait(1, now)
+	if w := l.bytes.wait(float64(size), now); w > wait {
+		wait = w
+	}
+	if wait > 0 {
+		l.rejected++
+		return false, wait
+	}
+
+	l.messages.take(1)
+	l.bytes.take(float64(size))
+	l.rejected = 0
+	return true, 0
+}
+
+// allowTyping проверяет лимит событий typing
+// (лишние просто отбрасываются, во флуд не засчитываются)
+func (l *clientLimits) allowTyping() bool {
+	if l.typing.wait(1, time.Now()) > 0 {
+		return false
+	}
+	l.typing.take(1)
+	return true
+}
+
+// flooding — клиент не останавливается, хотя сообщения отклоняются
+// (true один раз — когда счётчик дошёл до -flood-kick)
+func (l *clientLimits) flooding() bool {
+	return floodKick > 0 && l.rejected == floodKick
+}
+
+// ============================================================
+// ЛИМИТЫ IP
+// ============================================================
+
+// ipLimiter считает соединения и созданные комнаты по IP
+type ipLimiter struct {
+	mu        sync.Mutex
+	conns     map[string]int
+	creates   map[string]*tokenBucket
+	lastSweep time.Time
+
+	rejectedConns   int64
+	rejectedCreates int64
+}
+
+// limiter — лимиты IP, общие для всего сервера
+var limiter = &ipLimiter{
+	conns:   make(map[string]int),
+	creates: make(map[string]*tokenBucket),
+}
+
+// Connect учитывает новое соединение; false — с этого IP их слишком много
+func (l *ipLimiter) Connect(ip string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if maxConnsPerIP > 0 && l.conns[ip] >= maxConnsPerIP {
+		l.rejectedConns++
+		return false
+	}
+	l.conns[ip]++
+	return true
+}
+
+// Disconnect вызывается, когда соединение, принятое Connect, закрылось
+func (l *ipLimiter) Disconnect(ip string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.conns[ip]--
+	if l.conns[ip] <= 0 {
+		delete(l.conns, ip)
+	}
+}
+
+// AllowCreate проверяет, можно ли этому IP сейчас создать комнату
+// Если нельзя — возвращает сколько подождать
+func (l *ipLimiter) AllowCreate(ip string) (bool, time.Duration) {
+	if createRate <= 0 {
+		return true, 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.sweep(now)
+
+	b, ok := l.creates[ip]
+	if !ok {
+		// -create-rate задан в минуту, ведро считает в секунду
+		b = newBucket(createRate/60, createBurst)
+		l.creates[ip] = b
+	}
+
+	if wait := b.wait(1, now); wait > 0 {
+		l.rejectedCreates++
+		return false, wait
+	}
+	b.take(1)
+	return true, 0
+}
+
+// Stats возвращает число отклонённых соединений и созданий комнат
+func (l *ipLimiter) Stats() (conns, creates int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.rejectedConns, l.rejectedCreates
+}
+
+// sweep раз в минуту удаляет вёдра, которые уже снова полные (под l.mu)
+func (l *ipLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < time.Minute {
+		return
+	}
+	l.lastSweep = now
+
+	for ip, b := range l.creates {
+		if b.full(now) {
+			delete(l.creates, ip)
+		}
+	}
+}
+
+// rateLimited собирает ошибку rate_limited с подсказкой, сколько ждать
+func rateLimited(message string, wait time.Duration) *protocol.Error {
+	seconds := int(wait.Seconds()) + 1
+	return &protocol.Error{
+		Code:       protocol.ErrRateLimited,
+		Message:    fmt.Sprintf("%s, try again in %d s", message, seconds),
+		RetryAfter: seconds,
+	}
+}
+
+// throttleMessage применяет лимиты сообщений к chat или direct от client
+//
+// Возвращает false, если сообщение надо отбросить. Первое отклонённое
+// подряд получает rate_limited, флудер отключается.
+func throttleMessage(client *Client, room *Room, size int) bool {
+	ok, wait := client.limits.allowMessage(size)
+	if ok {
+		return true
+	}
+
+	metricRateLimited.Inc()
+	if client.limits.flooding() {
+		metricFloodKicks.Inc()
+		logger.Warn("flood_disconnect", "room", room.Code, "user", client.Username, "remote_addr", client.Conn.RemoteAddr(), "rejected", client.limits.rejected)
+		client.Send(errorFrame(protocol.ErrRateLimited, "Disconnected for flooding"))
+		client.Close()
+		return false
+	}
+	if client.limits.rejected == 1 {
+		f, _ := protocol.NewFrame(protocol.TypeError, rateLimited("You are sending messages too fast", wait))
+		client.Send(f)
+	}
+	return false
+}
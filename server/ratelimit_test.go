@@ -0,0 +1,163 @@
+package main
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"messenger-protocol"
+)
+
+// quietLogger глушит лог на время теста
+func quietLogger(t *testing.T) {
+	old := logger
+	logger = mustLogger(newLogger(io.Discard, "logfmt", "info", true))
+	t.Cleanup(func() { logger = old })
+}
+
+func TestTokenBucket(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+
+	// Ведро на 2 токена в секунду, вместимость 4
+	type step struct {
+		at   time.Duration // от start
+		n    float64
+		wait time.Duration // 0 — токены есть и забираются
+	}
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{"burst", []step{{0, 1, 0}, {0, 1, 0}, {0, 1, 0}, {0, 1, 0}, {0, 1, 500 * time.Millisecond}}},
+		{"refill", []step{{0, 4, 0}, {0, 1, 500 * time.Millisecond}, {500 * time.Millisecond, 1, 0}}},
+		{"partial wait", []step{{0, 4, 0}, {250 * time.Millisecond, 1, 250 * time.Millisecond}}},
+		{"never above burst", []step{{0, 4, 0}, {time.Hour, 5, 500 * time.Millisecond}, {time.Hour, 4, 0}}},
+		{"big request", []step{{0, 6, time.Second}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newBucket(2, 4)
+			b.last = start
+
+			for i, s := range tt.steps {
+				wait := b.wait(s.n, start.Add(s.at))
+				if wait != s.wait {
+					t.Fatalf("step %d: wait(%v) = %v, want %v", i, s.n, wait, s.wait)
+				}
+				if wait == 0 {
+					b.take(s.n)
+				}
+			}
+		})
+	}
+}
+
+func TestTokenBucketFull(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	b := newBucket(2, 4)
+	b.last = start
+
+	b.take(1)
+	if b.full(start) {
+		t.Error("full right after take")
+	}
+	if !b.full(start.Add(500 * time.Millisecond)) {
+		t.Error("not full after refilling")
+	}
+}
+
+func TestNoLimitBucket(t *testing.T) {
+	b := newBucket(0, 10)
+	if b != nil {
+		t.Fatal("rate 0 should mean no bucket")
+	}
+	if wait := b.wait(1e9, time.Now()); wait != 0 {
+		t.Errorf("nil bucket wait = %v, want 0", wait)
+	}
+	b.take(1) // не паникует
+}
+
+// newTestClient — клиент без writeLoop: отправленные фреймы остаются в очереди
+func newTestClient(t *testing.T) *Client {
+	conn, peer := net.Pipe()
+	t.Cleanup(func() { conn.Close(); peer.Close() })
+
+	return &Client{
+		Conn:     conn,
+		Username: "bob",
+		queue:    make(chan protocol.Frame, 16),
+		closing:  make(chan struct{}),
+		flushed:  make(chan struct{}),
+		limits:   newClientLimits(),
+	}
+}
+
+// sentErrors — ошибки, которые ждут отправки клиенту
+func sentErrors(t *testing.T, client *Client) []protocol.Error {
+	var errs []protocol.Error
+	for {
+		select {
+		case f := <-client.queue:
+			var e protocol.Error
+			if f.Type != protocol.TypeError {
+				t.Fatalf("unexpected %s frame", f.Type)
+			}
+			if err := f.Decode(&e); err != nil {
+				t.Fatal(err)
+			}
+			errs = append(errs, e)
+		default:
+			return errs
+		}
+	}
+}
+
+func TestThrottleMessage(t *testing.T) {
+	quietLogger(t)
+
+	oldRate, oldBurst, oldKick := messageRate, messageBurst, floodKick
+	messageRate, messageBurst, floodKick = 1, 2, 4
+	t.Cleanup(func() { messageRate, messageBurst, floodKick = oldRate, oldBurst, oldKick })
+
+	client := newTestClient(t)
+	room := NewRoom("12345678", "alice", RoomSettings{})
+
+	tests := []struct {
+		name       string
+		allowed    bool
+		wantErrors int  // сколько ошибок ушло клиенту
+		wantClosed bool // клиент отключён
+	}{
+		{"first of the burst", true, 0, false},
+		{"second of the burst", true, 0, false},
+		{"first rejected: rate_limited", false, 1, false},
+		{"second rejected: silent", false, 0, false},
+		{"third rejected: silent", false, 0, false},
+		{"flood-kick reached", false, 1, true},
+	}
+
+	for _, tt := range tests {
+		allowed := throttleMessage(client, room, 10)
+		if allowed != tt.allowed {
+			t.Fatalf("%s: allowed = %v, want %v", tt.name, allowed, tt.allowed)
+		}
+
+		errs := sentErrors(t, client)
+		if len(errs) != tt.wantErrors {
+			t.Fatalf("%s: %d errors sent, want %d", tt.name, len(errs), tt.wantErrors)
+		}
+		for _, e := range errs {
+			if e.Code != protocol.ErrRateLimited {
+				t.Errorf("%s: error code %q, want %q", tt.name, e.Code, protocol.ErrRateLimited)
+			}
+			if !tt.wantClosed && e.RetryAfter < 1 {
+				t.Errorf("%s: retry_after = %d, want at least 1", tt.name, e.RetryAfter)
+			}
+		}
+		if client.isClosing() != tt.wantClosed {
+			t.Fatalf("%s: closing = %v, want %v", tt.name, client.isClosing(), tt.wantClosed)
+		}
+	}
+}
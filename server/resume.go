@@ -0,0 +1,164 @@
+package main
+
+// ============================================================
+// ВОЗВРАЩЕНИЕ ПОСЛЕ ОБРЫВА СВЯЗИ (RESUME)
+// ============================================================
+//
+// В каждом ack клиент получает новый resume token. Если связь
+// оборвалась, клиент подключается заново и присылает join с этим
+// токеном и номером последнего увиденного сообщения (last_seq):
+//   - пароль и knock не нужны — клиент уже был в комнате
+//   - старое соединение, если сервер ещё не заметил обрыв, закрывается
+//   - клиент получает сообщения после last_seq из истории, а в ack.Dropped —
+//     сколько пропущенных сообщений история уже не хранит
+//
+// Токен годится, пока клиент в комнате, и ещё -resume-window после обрыва.
+// Пустая временная комната живёт столько же, чтобы было куда вернуться.
+
+import (
+	"time"
+
+	"messenger-protocol"
+)
+
+// resumeWindow — сколько ждать вернувшегося клиента (флаг -resume-window)
+var resumeWindow = 2 * time.Minute
+
+// resumeEntry — выданный токен одного участника
+type resumeEntry struct {
+	hash    string    // SHA-256 токена (см. secret.go)
+	client  *Client   // текущее соединение; nil — связь оборвалась
+	expires time.Time // после обрыва: до какого момента можно вернуться
+}
+
+// issueResume выдаёт клиенту новый токен (вызывается под r.mu)
+func (r *Room) issueResume(client *Client) (string, error) {
+	token, err := newToken()
+	if err != nil {
+		return "", err
+	}
+
+	r.resumes[client.Username] = &resumeEntry{hash: hashToken(token), client: client}
+	return token, nil
+}
+
+// checkResume проверяет токен username
+func (r *Room) checkResume(username, token string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	e, ok := r.resumes[username]
+	if !ok || !checkToken(token, e.hash) {
+		return false
+	}
+	return e.client != nil || time.Now().Before(e.expires)
+}
+
+// suspendResume запускает окно возврата после ухода client
+func (r *Room) suspendResume(client *Client) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// Токен мог уже перейти к новому соединению того же пользователя
+	if e, ok := r.resumes[client.Username]; ok && e.client == client {
+		e.client = nil
+		e.expires = time.Now().Add(resumeWindow)
+	}
+}
+
+// revokeResume отзывает токен (например, когда оператор выгнал клиента)
+func (r *Room) revokeResume(username string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.resumes, username)
+}
+
+// hasPendingResumes — кто-то ещё может вернуться в комнату
+// (заодно забывает просроченные токены)
+func (r *Room) hasPendingResumes() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	pending := false
+	now := time.Now()
+	for username, e := range r.resumes {
+		switch {
+		case e.client != nil:
+		case now.Before(e.expires):
+			pending = true
+		default:
+			delete(r.resumes, username)
+		}
+	}
+	return pending
+}
+
+// missedSince возвращает сообщения после seq и сколько из пропущенных
+// уже вытеснено из истории (вызывается под r.mu)
+func (r *Room) missedSince(seq uint64) ([]protocol.Chat, int) {
+	// Сервер перезапускался — номера начались заново
+	if seq > r.lastSeq {
+		return nil, 0
+	}
+
+	var missed []protocol.Chat
+	for _, chat := range r.history.All() {
+		if chat.Seq > seq {
+			missed = append(missed, chat)
+		}
+	}
+	return missed, int(r.lastSeq-seq) - len(missed)
+}
+
+// resumeRoom возвращает client в комнату по resume token
+func resumeRoom(client *Client, room *Room, join protocol.Join) (*Room, error) {
+	username := client.Username
+	client.Owner = checkToken(join.OwnerToken, room.Settings.OwnerTokenHash)
+	client.ResumeSeq = join.LastSeq
+	client.MemberToken = join.MemberToken
+
+	// Старое соединение могло ещё не заметить обрыв — заменяем его.
+	// Его handleClient увидит, что клиента уже убрали, и не станет
+	// сообщать комнате об уходе.
+	for _, old := range room.ClientList() {
+		if old.Name() == username {
+			room.RemoveClient(old)
+			old.Abort()
+		}
+	}
+
+	newMember, err := room.Join(client, protocol.Ack{Message: "Reconnected to room " + room.Code, Resumed: true})
+	if err != nil {
+		room.RemoveClient(client)
+		return nil, err
+	}
+	if newMember {
+		saveRoom(room)
+	}
+
+	room.Broadcast(systemFrame(protocol.EventJoined, username, username+" reconnected"), client)
+
+	logger.Info("room_resumed", "room", room.Code, "user", username, "remote_addr", client.Conn.RemoteAddr(), "last_seq", join.LastSeq)
+	return room, nil
+}
+
+// removeIfAbandoned удаляет пустую временную комнату, когда
+// вернуться в неё уже никто не может
+func removeIfAbandoned(room *Room) {
+	if room.GetClientCount() > 0 || room.Settings.Persistent || GetRoom(room.Code) != room {
+		return
+	}
+
+	// Кто-то ещё может вернуться — проверим позже
+	if room.hasPendingResumes() {
+		time.AfterFunc(resumeWindow, func() { removeIfAbandoned(room) })
+		return
+	}
+
+	if err := DeleteRoom(room.Code); err != nil {
+		logger.Error("room_delete_failed", "room", room.Code, "error", err)
+		return
+	}
+	logger.Info("room_deleted", "room", room.Code, "reason", "empty")
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"messenger-protocol"
+)
+
+func TestResumeToken(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(r *Room, client *Client) // что случилось после выдачи токена
+		user  string
+		token string // "" — выданный токен
+		want  bool
+	}{
+		{"still connected", func(r *Room, c *Client) {}, "bob", "", true},
+		{"dropped, within the window", func(r *Room, c *Client) {
+			r.suspendResume(c)
+		}, "bob", "", true},
+		{"dropped, window expired", func(r *Room, c *Client) {
+			r.suspendResume(c)
+			r.resumes["bob"].expires = time.Now().Add(-time.Second)
+		}, "bob", "", false},
+		{"wrong token", func(r *Room, c *Client) {}, "bob", "0123456789abcdef0123456789abcdef", false},
+		{"other user's token", func(r *Room, c *Client) {}, "alice", "", false},
+		{"revoked", func(r *Room, c *Client) {
+			r.revokeResume("bob")
+		}, "bob", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			room := NewRoom("12345678", "alice", RoomSettings{})
+			bob := &Client{Username: "bob"}
+			token, err := room.issueResume(bob)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.setup(room, bob)
+
+			if tt.token != "" {
+				token = tt.token
+			}
+			if got := room.checkResume(tt.user, token); got != tt.want {
+				t.Errorf("checkResume(%q) = %v, want %v", tt.user, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResumeTokenReissued(t *testing.T) {
+	room := NewRoom("12345678", "alice", RoomSettings{})
+	old := &Client{Username: "bob"}
+	oldToken, _ := room.issueResume(old)
+
+	// Вернулся с новым соединением: старый токен больше не годится,
+	// а обрыв старого соединения не трогает новый токен
+	current := &Client{Username: "bob"}
+	token, _ := room.issueResume(current)
+	room.suspendResume(old)
+
+	if room.checkResume("bob", oldToken) {
+		t.Error("old token still accepted")
+	}
+	if e := room.resumes["bob"]; e.client != current {
+		t.Error("suspending the old connection suspended the new one")
+	}
+	if !room.checkResume("bob", token) {
+		t.Error("new token rejected")
+	}
+}
+
+func TestHasPendingResumes(t *testing.T) {
+	old := resumeWindow
+	resumeWindow = time.Minute
+	t.Cleanup(func() { resumeWindow = old })
+
+	room := NewRoom("12345678", "alice", RoomSettings{})
+	if room.hasPendingResumes() {
+		t.Fatal("empty room has pending resumes")
+	}
+
+	bob := &Client{Username: "bob"}
+	room.issueResume(bob)
+	if room.hasPendingResumes() {
+		t.Error("connected client counted as pending")
+	}
+
+	room.suspendResume(bob)
+	if !room.hasPendingResumes() {
+		t.Error("dropped client within the window not pending")
+	}
+
+	room.resumes["bob"].expires = time.Now().Add(-time.Second)
+	if room.hasPendingResumes() {
+		t.Error("expired token still pending")
+	}
+	if _, ok := room.resumes["bob"]; ok {
+		t.Error("expired token not forgotten")
+	}
+}
+
+func TestMissedSince(t *testing.T) {
+	oldSize := historySize
+	historySize = 3
+	t.Cleanup(func() { historySize = oldSize })
+
+	room := NewRoom("12345678", "alice", RoomSettings{})
+	for seq := uint64(1); seq <= 5; seq++ {
+		room.lastSeq = seq
+		room.history.Add(protocol.Chat{Seq: seq})
+	}
+
+	tests := []struct {
+		name        string
+		seq         uint64
+		want        []uint64
+		wantDropped int
+	}{
+		{"nothing missed", 5, []uint64{}, 0},
+		{"all still in history", 3, []uint64{4, 5}, 0},
+		{"some pushed out", 0, []uint64{3, 4, 5}, 2},
+		{"server restarted", 9, []uint64{}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			missed, dropped := room.missedSince(tt.seq)
+			if got := seqs(missed); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("missedSince(%d) = %v, want %v", tt.seq, got, tt.want)
+			}
+			if dropped != tt.wantDropped {
+				t.Errorf("missedSince(%d) dropped = %d, want %d", tt.seq, dropped, tt.wantDropped)
+			}
+		})
+	}
+}
@@ -1,8 +1,13 @@
 package main
 
 import (
+	"errors"
 	"net"
+	"strings"
 	"sync"
+	"time"
+
+	"messenger-protocol"
 )
 
 // ============================================================
@@ -11,89 +16,250 @@ import (
 
 // Client — один подключённый пользователь
 type Client struct {
-	Conn     net.Conn // соединение с клиентом
-	Username string   // имя пользователя
+	Conn         net.Conn  // соединение с клиентом
+	Username     string    // имя пользователя (меняет только setName, см. Name)
+	Capabilities []string  // возможности, согласованные в handshake
+	Owner        bool      // создатель комнаты (или предъявил owner token)
+	JoinedAt     time.Time // когда вошёл в комнату
+	LastActive   time.Time // последнее сообщение в комнату (presence.go)
+	ResumeSeq    uint64    // последнее сообщение, которое клиент видел до обрыва (resume.go)
+	MemberToken  string    // токен участника постоянной комнаты из join (members.go)
+	Member       bool      // предъявил токен участника (или только что его получил)
+	PublicKey    string    // ключ для личных сообщений из hello (direct.go)
+
+	limits clientLimits // лимиты сообщений и байт (ratelimit.go)
+	nameMu sync.Mutex   // Username для чужих горутин (Name)
+
+	// Очередь отправки (sendqueue.go)
+	queue     chan protocol.Frame
+	closing   chan struct{}
+	closeOnce sync.Once
+	flushed   chan struct{}
 }
 
 // Room — комната чата
 type Room struct {
-	Code    string     // 5-значный код комнаты
-	Clients []*Client  // список клиентов в комнате
-	mu      sync.Mutex // мьютекс для безопасного доступа из разных горутин
+	Code      string       // код комнаты (см. code.go)
+	CreatedAt time.Time    // когда комнату создали
+	Owner     string       // username создателя
+	Settings  RoomSettings // настройки комнаты
+	Clients   []*Client    // список клиентов в комнате
+	mu        sync.Mutex   // мьютекс для безопасного доступа из разных горутин
+
+	history *historyBuffer          // последние сообщения (шифротекст)
+	lastSeq uint64                  // номер последнего сообщения в комнате
+	members map[string]*member      // известные участники (см. members.go)
+	knocks  map[string]chan bool    // ожидающие одобрения (см. knock.go)
+	resumes map[string]*resumeEntry // токены для возврата (см. resume.go)
+}
+
+// RoomSettings — настройки, которые сохраняются вместе с комнатой
+type RoomSettings struct {
+	Persistent bool `json:"persistent"` // не удалять комнату, когда все вышли
+	Knock      bool `json:"knock"`      // вход только с одобрения владельца
+
+	// Пароль на вход: PBKDF2-хеш и соль (см. secret.go)
+	SecretHash string `json:"secret_hash,omitempty"`
+	SecretSalt string `json:"secret_salt,omitempty"`
+
+	// SHA-256 от токена владельца
+	OwnerTokenHash string `json:"owner_token_hash,omitempty"`
+}
+
+// NewRoom создаёт пустую комнату
+func NewRoom(code, owner string, settings RoomSettings) *Room {
+	return &Room{
+		Code:      code,
+		CreatedAt: time.Now(),
+		Owner:     owner,
+		Settings:  settings,
+		Clients:   make([]*Client, 0), // пустой список клиентов
+		history:   newHistoryBuffer(historySize),
+		members:   make(map[string]*member),
+		knocks:    make(map[string]chan bool),
+		resumes:   make(map[string]*resumeEntry),
+	}
 }
 
 // ============================================================
 // ХРАНИЛИЩЕ КОМНАТ
 // ============================================================
 
-// rooms — все активные комнаты
-// Ключ: код комнаты (например "12345")
-// Значение: указатель на комнату
-var rooms = make(map[string]*Room)
+// store — все активные комнаты (см. store.go)
+// По умолчанию в памяти, с флагом -store — в файле
+var store RoomStore = NewMemoryStore()
+
+// Лимиты (флаги -max-rooms и -max-clients, 0 — без ограничений)
+var (
+	maxRooms       = 0
+	maxRoomClients = 0
+)
 
-// roomsMu — мьютекс для безопасного доступа к rooms
-var roomsMu sync.Mutex
+var (
+	errTooManyRooms = errors.New("room limit reached")
+	errRoomFull     = &protocol.Error{Code: protocol.ErrRoomFull, Message: "The room is full"}
+)
 
 // ============================================================
 // ФУНКЦИИ ДЛЯ РАБОТЫ С КОМНАТАМИ
 // ============================================================
 
 // CreateRoom создаёт новую комнату и возвращает её код
-func CreateRoom() string {
-	roomsMu.Lock()         // блокируем доступ другим горутинам
-	defer roomsMu.Unlock() // разблокируем когда функция закончится
-
-	// Генерируем код (используем твою функцию из code.go!)
-	code := GenerateRoomCode()
-
-	// Проверяем что такой код ещё не занят
-	// Если занят — генерируем новый (простая защита)
-	for rooms[code] != nil {
-		code = GenerateRoomCode()
-	}
-
-	// Создаём комнату
-	room := &Room{
-		Code:    code,
-		Clients: make([]*Client, 0), // пустой список клиентов
+func CreateRoom(owner string, settings RoomSettings) (string, error) {
+	if maxRooms > 0 && store.Count() >= maxRooms {
+		return "", errTooManyRooms
 	}
 
-	// Сохраняем в хранилище
-	rooms[code] = room
+	for {
+		// Генерируем код (формат выбирается флагом -code-format)
+		code, err := GenerateRoomCode()
+		if err != nil {
+			return "", err
+		}
 
-	return code
+		// Create сам проверяет что такой код ещё не занят
+		// Если занят — генерируем новый (простая защита)
+		err = store.Create(NewRoom(code, owner, settings))
+		if err == ErrRoomExists {
+			continue
+		}
+		if err == nil {
+			metricRoomsCreated.Inc()
+		}
+		return code, err
+	}
 }
 
 // GetRoom возвращает комнату по коду (или nil если не найдена)
 func GetRoom(code string) *Room {
-	roomsMu.Lock()
-	defer roomsMu.Unlock()
-
-	return rooms[code]
+	return store.Get(code)
 }
 
 // DeleteRoom удаляет комнату
-func DeleteRoom(code string) {
-	roomsMu.Lock()
-	defer roomsMu.Unlock()
-
-	delete(rooms, code)
+func DeleteRoom(code string) error {
+	if err := store.Delete(code); err != nil {
+		return err
+	}
+	metricRoomsDeleted.Inc()
+	return nil
 }
 
 // ============================================================
 // МЕТОДЫ КОМНАТЫ
 // ============================================================
 
-// AddClient добавляет клиента в комнату
-func (r *Room) AddClient(client *Client) {
+// Join добавляет клиента в комнату
+//
+// Под мьютексом комнаты: отправляем ack, затем пропущенные сообщения,
+// и только потом добавляем клиента в список. Так живые сообщения
+// из Relay не могут прийти раньше ack или вклиниться в середину.
+//
+// Что считается пропущенным:
+//   - вернувшийся участник постоянной комнаты получает свою офлайн-очередь,
+//     если предъявил токен участника (members.go)
+//   - все остальные получают общую историю (если умеют CapHistory)
+//
+// Новый участник постоянной комнаты получает в ack свой токен.
+//
+// Если имя занято, в режиме -duplicate-names=suffix клиент получает
+// новое (client.Username меняется), иначе — ошибка username_taken.
+//
+// Возвращает true, если в постоянной комнате появился новый участник
+// или участник из старого файла получил токен
+// (тогда комнату стоит сохранить в store).
+func (r *Room) Join(client *Client, ack protocol.Ack) (bool, error) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
+	if maxRoomClients > 0 && len(r.Clients) >= maxRoomClients {
+		return false, errRoomFull
+	}
+
+	// Имя должно быть свободно (username.go). Вернувшемуся после обрыва
+	// проверять нечего: его старое соединение уже убрано.
+	if !ack.Resumed {
+		if err := r.claimName(client); err != nil {
+			return false, err
+		}
+	}
+
+	var backlog []protocol.Chat
+	var dropped int
+	offline := false
+	newMember := false
+	restarted := false
+
+	if r.Settings.Persistent {
+		m, token, err := r.admitMember(client)
+		if err != nil {
+			return false, err
+		}
+		if m != nil {
+			backlog, dropped = m.take(time.Now())
+			offline = true
+			restarted, m.restored = m.restored, false
+		}
+		if token != "" {
+			ack.MemberToken = token
+			newMember = true
+		}
+	}
+
+	switch {
+	case ack.Resumed:
+		// Вернулся после обрыва: ровно то, что пропустил (resume.go).
+		// Офлайн-очередь при этом не нужна — она уже очищена выше.
+		backlog, dropped = r.missedSince(client.ResumeSeq)
+		offline = false
+	case !offline && protocol.HasCapability(client.Capabilities, protocol.CapHistory):
+		backlog = r.history.All()
+	}
+
+	token, err := r.issueResume(client)
+	if err != nil {
+		return newMember, err
+	}
+	ack.ResumeToken = token
+
+	ack.Room = r.Code
+	ack.Username = client.Username
+	ack.History = len(backlog)
+	ack.Offline = offline
+	ack.Dropped = dropped
+	ack.Members = len(r.Clients) + 1
+
+	f, err := protocol.NewFrame(protocol.TypeAck, ack)
+	if err != nil {
+		return newMember, err
+	}
+	if err := client.Send(f); err != nil {
+		return newMember, err
+	}
+
+	for _, chat := range backlog {
+		chat.History = true
+		f, err := protocol.NewFrame(protocol.TypeChat, chat)
+		if err != nil {
+			return newMember, err
+		}
+		if err := client.Send(f); err != nil {
+			return newMember, err
+		}
+	}
+	if restarted {
+		client.Send(systemFrame(protocol.EventNotice, "",
+			"The server restarted since you were last here: messages sent to you before the restart were not kept"))
+	}
+
+	client.JoinedAt = time.Now()
+	client.LastActive = client.JoinedAt
 	r.Clients = append(r.Clients, client)
+	return newMember, nil
 }
 
 // RemoveClient удаляет клиента из комнаты
-func (r *Room) RemoveClient(client *Client) {
+// Возвращает false, если клиента в комнате уже не было
+func (r *Room) RemoveClient(client *Client) bool {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
@@ -105,22 +271,128 @@ func (r *Room) RemoveClient(client *Client) {
 			// r.Clients[i+1:] — всё после элемента
 			// append соединяет их, пропуская удаляемый
 			r.Clients = append(r.Clients[:i], r.Clients[i+1:]...)
-			break
+			return true
+		}
+	}
+	return false
+}
+
+// Broadcast отправляет фрейм ВСЕМ клиентам в комнате
+func (r *Room) Broadcast(f protocol.Frame, sender *Client) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.sendAll(f, sender)
+}
+
+// BroadcastTo — Broadcast только для клиентов с возможностью capability
+func (r *Room) BroadcastTo(f protocol.Frame, sender *Client, capability string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, client := range r.Clients {
+		if client != sender && protocol.HasCapability(client.Capabilities, capability) {
+			client.Send(f)
 		}
 	}
 }
 
-// Broadcast отправляет сообщение ВСЕМ клиентам в комнате
-func (r *Room) Broadcast(message string, sender *Client) {
+// SendTo отправляет фрейм одному участнику комнаты с возможностью
+// capability; имя сравнивается без учёта регистра, как в username.go
+//
+// Возвращает false, если такого участника в комнате нет.
+func (r *Room) SendTo(username string, f protocol.Frame, capability string) bool {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
+	for _, client := range r.Clients {
+		if strings.EqualFold(client.Username, username) && protocol.HasCapability(client.Capabilities, capability) {
+			client.Send(f)
+			return true
+		}
+	}
+	return false
+}
+
+// sendAll ставит фрейм в очереди всех кроме sender (под r.mu)
+//
+// Send не блокируется, поэтому r.mu держится недолго. Клиента
+// с переполненной очередью Send отключает сам, через Abort — тоже
+// без ожидания, даже если писатель завис в записи (WebSocket).
+func (r *Room) sendAll(f protocol.Frame, sender *Client) {
+	start := time.Now()
+
 	for _, client := range r.Clients {
 		// Не отправляем сообщение самому отправителю
 		if client != sender {
-			client.Conn.Write([]byte(message))
+			client.Send(f)
 		}
 	}
+
+	metricBroadcastLatency.ObserveSince(start)
+}
+
+// Relay рассылает chat-сообщение и запоминает его в истории
+//
+// Номер и время сообщения ставит сервер.
+func (r *Room) Relay(chat protocol.Chat, sender *Client) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	sender.LastActive = now
+
+	r.lastSeq++
+	chat.Seq = r.lastSeq
+	chat.Time = now.Unix()
+	r.history.Add(chat)
+	r.enqueueOffline(chat)
+
+	f, err := protocol.NewFrame(protocol.TypeChat, chat)
+	if err != nil {
+		return err
+	}
+
+	metricMessages.Inc()
+	r.sendAll(f, sender)
+	return nil
+}
+
+// Name возвращает имя клиента
+//
+// Имя меняет только горутина самого клиента (/nick, суффикс при входе),
+// поэтому она и код под r.mu читают Username напрямую. Остальные —
+// писатель очереди, админка, resume другого соединения — через Name.
+func (c *Client) Name() string {
+	c.nameMu.Lock()
+	defer c.nameMu.Unlock()
+
+	return c.Username
+}
+
+// setName меняет имя клиента (в комнате — под r.mu)
+func (c *Client) setName(name string) {
+	c.nameMu.Lock()
+	defer c.nameMu.Unlock()
+
+	c.Username = name
+}
+
+// OwnerName возвращает имя владельца (его меняет Rename)
+func (r *Room) OwnerName() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.Owner
+}
+
+// ClientList возвращает копию списка клиентов
+// (по копии можно ходить без мьютекса комнаты)
+func (r *Room) ClientList() []*Client {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]*Client(nil), r.Clients...)
 }
 
 // GetClientCount возвращает количество клиентов в комнате
@@ -0,0 +1,111 @@
+package main
+
+// ============================================================
+// ПАРОЛИ КОМНАТ И ТОКЕНЫ ВЛАДЕЛЬЦА
+// ============================================================
+//
+// Пароль комнаты (join secret) никак не связан с ключом шифрования:
+// ключ сервер не видит никогда, а пароль проверяет именно сервер,
+// чтобы посторонний с угаданным кодом вообще не попал в комнату.
+//
+// На сервере хранится только соль + PBKDF2-HMAC-SHA256 от пароля.
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/binary"
+	"encoding/hex"
+)
+
+// Параметры PBKDF2
+const (
+	secretIterations = 100000
+	secretSaltSize   = 16
+	secretKeySize    = 32
+)
+
+// hashSecret возвращает (хеш, соль) для пароля комнаты в hex
+func hashSecret(secret string) (string, string, error) {
+	salt := make([]byte, secretSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return "", "", err
+	}
+
+	key := pbkdf2SHA256([]byte(secret), salt, secretIterations, secretKeySize)
+	return hex.EncodeToString(key), hex.EncodeToString(salt), nil
+}
+
+// checkSecret сравнивает пароль с сохранённым хешем
+// Сравнение за постоянное время — по времени ответа ничего не узнать
+func checkSecret(secret, hashHex, saltHex string) bool {
+	want, err := hex.DecodeString(hashHex)
+	if err != nil {
+		return false
+	}
+	salt, err := hex.DecodeString(saltHex)
+	if err != nil {
+		return false
+	}
+
+	got := pbkdf2SHA256([]byte(secret), salt, secretIterations, len(want))
+	return subtle.ConstantTimeCompare(got, want) == 1
+}
+
+// newToken создаёт случайный токен (128 бит, hex)
+func newToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// hashToken — SHA-256 от токена
+// Токен и так случайный, поэтому соль и PBKDF2 ему не нужны
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// checkToken сравнивает токен с сохранённым хешем
+func checkToken(token, hashHex string) bool {
+	if token == "" || hashHex == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(hashToken(token)), []byte(hashHex)) == 1
+}
+
+// pbkdf2SHA256 — PBKDF2 (RFC 8018) с HMAC-SHA256
+func pbkdf2SHA256(password, salt []byte, iterations, keyLen int) []byte {
+	prf := hmac.New(sha256.New, password)
+	hashLen := prf.Size()
+	blocks := (keyLen + hashLen - 1) / hashLen
+
+	key := make([]byte, 0, blocks*hashLen)
+	var counter [4]byte
+	for block := 1; block <= blocks; block++ {
+		// U1 = PRF(password, salt || INT(block))
+		prf.Reset()
+		prf.Write(salt)
+		binary.BigEndian.PutUint32(counter[:], uint32(block))
+		prf.Write(counter[:])
+		u := prf.Sum(nil)
+
+		t := make([]byte, len(u))
+		copy(t, u)
+
+		// T = U1 ^ U2 ^ ... ^ Uc
+		for i := 1; i < iterations; i++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for j := range t {
+				t[j] ^= u[j]
+			}
+		}
+		key = append(key, t...)
+	}
+	return key[:keyLen]
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+func TestPBKDF2SHA256(t *testing.T) {
+	// Векторы PBKDF2-HMAC-SHA256 (RFC 7914 и широко известные
+	// значения для "password"/"salt")
+	tests := []struct {
+		password, salt string
+		iterations     int
+		keyLen         int
+		want           string
+	}{
+		{"password", "salt", 1, 32, "120fb6cffcf8b32c43e7225256c4f837a86548c92ccc35480805987cb70be17b"},
+		{"password", "salt", 2, 32, "ae4d0c95af6b46d32d0adff928f06dd02a303f8ef3c251dfd6e2d85a95474c43"},
+		{"password", "salt", 4096, 32, "c5e478d59288c841aa530db6845c4c8d962893a001ce4e11a4963873aa98134a"},
+		{"password", "salt", 1, 16, "120fb6cffcf8b32c43e7225256c4f837"},
+		// Два блока: ключ длиннее одного хеша
+		{"passwordPASSWORDpassword", "saltSALTsaltSALTsaltSALTsaltSALTsalt", 4096, 40,
+			"348c89dbcbd32b2f32d814b8116e84cf2b17347ebc1800181c4e2a1fb8dd53e1c635518c7dac47e9"},
+	}
+
+	for _, tt := range tests {
+		got := hex.EncodeToString(pbkdf2SHA256([]byte(tt.password), []byte(tt.salt), tt.iterations, tt.keyLen))
+		if got != tt.want {
+			t.Errorf("pbkdf2(%q, %q, %d, %d) = %s, want %s", tt.password, tt.salt, tt.iterations, tt.keyLen, got, tt.want)
+		}
+	}
+}
+
+func TestCheckSecret(t *testing.T) {
+	hash, salt, err := hashSecret("hunter2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Соль каждый раз новая
+	if _, salt2, _ := hashSecret("hunter2"); salt2 == salt {
+		t.Error("hashSecret returned the same salt twice")
+	}
+
+	tests := []struct {
+		name               string
+		secret, hash, salt string
+		want               bool
+	}{
+		{"right secret", "hunter2", hash, salt, true},
+		{"wrong secret", "hunter3", hash, salt, false},
+		{"empty secret", "", hash, salt, false},
+		{"other salt", "hunter2", hash, "00112233445566778899aabbccddeeff", false},
+		{"bad hash hex", "hunter2", "zz", salt, false},
+		{"bad salt hex", "hunter2", hash, "zz", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := checkSecret(tt.secret, tt.hash, tt.salt); got != tt.want {
+				t.Errorf("checkSecret(%q) = %v, want %v", tt.secret, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckToken(t *testing.T) {
+	token, err := newToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(token) != 32 {
+		t.Fatalf("newToken() = %q, want 32 hex characters", token)
+	}
+	hash := hashToken(token)
+
+	tests := []struct {
+		name        string
+		token, hash string
+		want        bool
+	}{
+		{"right token", token, hash, true},
+		{"wrong token", token + "0", hash, false},
+		{"no token", "", hash, false},
+		{"no hash", token, "", false},
+		{"hash as token", hash, hash, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := checkToken(tt.token, tt.hash); got != tt.want {
+				t.Errorf("checkToken() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+// ============================================================
+// ОЧЕРЕДЬ ОТПРАВКИ КЛИЕНТУ
+// ============================================================
+//
+// Раньше Broadcast писал в сокет каждого клиента прямо под r.mu:
+// один зависший клиент останавливал всю комнату.
+//
+// Теперь у каждого клиента своя очередь и своя горутина-писатель:
+//   - Send только кладёт фрейм в очередь и никогда не блокируется
+//   - писатель отправляет фреймы по одному, с дедлайном на запись
+//   - очередь переполнилась — клиент не успевает читать, отключаем его
+//   - ошибка записи — отключаем и пишем в лог (и в метрики)
+
+import (
+	"errors"
+	"net"
+	"time"
+
+	"messenger-protocol"
+)
+
+// Настройки очереди (флаги -send-queue и -write-timeout)
+var (
+	sendQueueSize = 256
+	writeTimeout  = 10 * time.Second
+)
+
+var (
+	errClientClosed = errors.New("client connection is closed")
+	errSlowConsumer = errors.New("client send queue is full")
+)
+
+// NewClient создаёт клиента и запускает его писателя
+func NewClient(conn net.Conn, username string, capabilities []string) *Client {
+	c := &Client{
+		Conn:         conn,
+		Username:     username,
+		Capabilities: capabilities,
+		queue:        make(chan protocol.Frame, sendQueueSize),
+		closing:      make(chan struct{}),
+		flushed:      make(chan struct{}),
+		limits:       newClientLimits(),
+	}
+	go c.writeLoop()
+	return c
+}
+
+// Send ставит фрейм в очередь клиента
+//
+// Не блокируется: если очередь полна, клиент отключается
+// и возвращается errSlowConsumer.
+func (c *Client) Send(f protocol.Frame) error {
+	if c.isClosing() {
+		return errClientClosed
+	}
+
+	select {
+	case c.queue <- f:
+		return nil
+	default:
+		metricSlowConsumers.Inc()
+		logger.Warn("slow_consumer", "user", c.Name(), "remote_addr", c.Conn.RemoteAddr(), "queue", sendQueueSize)
+		c.Abort()
+		return errSlowConsumer
+	}
+}
+
+// Close отправляет то, что уже в очереди, и закрывает соединение
+func (c *Client) Close() {
+	c.closeOnce.Do(func() {
+		close(c.closing)
+	})
+}
+
+// aborter — соединение, чей Close может ждать записи (wsConn)
+type aborter interface {
+	Abort() error
+}
+
+// Abort закрывает соединение сразу, не дожидаясь очереди
+//
+// Вызывается под r.mu (из Send), поэтому не должен ждать писателя:
+// у WebSocket обычный Close сначала пишет close-фрейм.
+func (c *Client) Abort() {
+	c.Close()
+	if conn, ok := c.Conn.(aborter); ok {
+		conn.Abort()
+		return
+	}
+	c.Conn.Close()
+}
+
+func (c *Client) isClosing() bool {
+	select {
+	case <-c.closing:
+		return true
+	default:
+		return false
+	}
+}
+
+// Flushed закрывается, когда писатель закончил работу
+func (c *Client) Flushed() <-chan struct{} {
+	return c.flushed
+}
+
+// writeLoop — горутина-писатель, одна на клиента
+func (c *Client) writeLoop() {
+	defer close(c.flushed)
+	defer c.Conn.Close()
+
+	for {
+		select {
+		case f := <-c.queue:
+			if !c.write(f) {
+				return
+			}
+		case <-c.closing:
+			// Дописываем то, что успели поставить в очередь
+			for {
+				select {
+				case f := <-c.queue:
+					if !c.write(f) {
+						return
+					}
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// write пишет один фрейм с дедлайном; false — соединение больше не годится
+func (c *Client) write(f protocol.Frame) bool {
+	c.Conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+
+	if err := protocol.WriteFrame(c.Conn, f); err != nil {
+		// После Close/Abort ошибки ожидаемы — соединение закрываем мы сами
+		if !c.isClosing() {
+			metricWriteErrors.Inc()
+			logger.Warn("write_failed", "user", c.Name(), "remote_addr", c.Conn.RemoteAddr(), "error", err)
+			c.Close()
+		}
+		return false
+	}
+
+	metricBytes.Add(int64(protocol.HeaderSize + len(f.Payload)))
+	return true
+}
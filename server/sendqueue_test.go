@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bufio"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"messenger-protocol"
+)
+
+// withSendQueue временно меняет размер очереди и таймаут записи
+func withSendQueue(t *testing.T, size int, timeout time.Duration) {
+	oldSize, oldTimeout := sendQueueSize, writeTimeout
+	sendQueueSize, writeTimeout = size, timeout
+	t.Cleanup(func() { sendQueueSize, writeTimeout = oldSize, oldTimeout })
+}
+
+// chatFrame — небольшой фрейм для очередей
+func chatFrame(t *testing.T, body string) protocol.Frame {
+	f, err := protocol.NewFrame(protocol.TypeChat, protocol.Chat{Body: body})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func TestSendSlowConsumer(t *testing.T) {
+	quietLogger(t)
+	withSendQueue(t, 2, time.Minute)
+
+	// Никто не читает: писатель зависает на первом фрейме,
+	// ещё два ложатся в очередь, четвёртому места нет
+	conn, peer := net.Pipe()
+	defer peer.Close()
+	client := NewClient(conn, "bob", nil)
+
+	before := atomic.LoadInt64(&metricSlowConsumers.value)
+
+	var err error
+	for i := 0; i < sendQueueSize+2 && err == nil; i++ {
+		err = client.Send(chatFrame(t, "hi"))
+	}
+	if err != errSlowConsumer {
+		t.Fatalf("Send() = %v, want errSlowConsumer", err)
+	}
+	if got := atomic.LoadInt64(&metricSlowConsumers.value) - before; got != 1 {
+		t.Errorf("slow consumer counted %d times, want 1", got)
+	}
+
+	select {
+	case <-client.Flushed():
+	case <-time.After(time.Second):
+		t.Fatal("writer still running after the client was dropped")
+	}
+	if _, err := conn.Write([]byte{0}); err == nil {
+		t.Error("connection still open after the client was dropped")
+	}
+	if err := client.Send(chatFrame(t, "late")); err != errClientClosed {
+		t.Errorf("Send() after drop = %v, want errClientClosed", err)
+	}
+}
+
+func TestCloseFlushesQueue(t *testing.T) {
+	quietLogger(t)
+	withSendQueue(t, 8, time.Minute)
+
+	conn, peer := net.Pipe()
+	defer peer.Close()
+	client := NewClient(conn, "bob", nil)
+
+	want := []string{"one", "two", "three"}
+	for _, body := range want {
+		if err := client.Send(chatFrame(t, body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	client.Close()
+
+	reader := bufio.NewReader(peer)
+	for _, body := range want {
+		f, err := protocol.ReadFrame(reader)
+		if err != nil {
+			t.Fatalf("reading %q: %v", body, err)
+		}
+		var chat protocol.Chat
+		if err := f.Decode(&chat); err != nil || chat.Body != body {
+			t.Errorf("got %q (%v), want %q", chat.Body, err, body)
+		}
+	}
+
+	// После очереди — конец соединения
+	if _, err := protocol.ReadFrame(reader); err == nil {
+		t.Error("connection still open after the queue was flushed")
+	}
+	<-client.Flushed()
+}
+
+func TestBroadcastStalledWebSocket(t *testing.T) {
+	quietLogger(t)
+	withSendQueue(t, 2, time.Minute)
+
+	// Браузер не читает: писатель висит в Write с захваченным writeMu
+	conn, peer := net.Pipe()
+	defer peer.Close()
+	ws := &wsConn{Conn: conn, reader: bufio.NewReader(conn)}
+	stalled := NewClient(ws, "bob", nil)
+
+	room := NewRoom("12345678", "alice", RoomSettings{})
+	room.Clients = append(room.Clients, stalled)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < sendQueueSize+2; i++ {
+			room.Broadcast(chatFrame(t, "hi"), nil)
+		}
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Broadcast blocked on a stalled WebSocket client")
+	}
+
+	select {
+	case <-stalled.Flushed():
+	case <-time.After(2 * time.Second):
+		t.Fatal("stalled client's writer was not stopped")
+	}
+}
@@ -2,32 +2,152 @@ package main
 
 import (
 	"bufio"
+	"crypto/tls"
+	"errors"
+	"flag"
 	"fmt"
 	"net"
+	"os"
 	"strings"
+
+	"messenger-protocol"
 )
 
 func main() {
+	// "go run . admin ..." — команды для работающего сервера (admin_cli.go)
+	if len(os.Args) > 1 && os.Args[1] == "admin" {
+		os.Exit(runAdminCLI(os.Args[2:]))
+	}
+
+	// ==========================================
+	// ШАГ 1: Читаем настройки (флаги, MESSENGER_*, файл — config.go)
+	// ==========================================
+
+	cfg, err := loadConfig(os.Args[1:])
+	if err == flag.ErrHelp {
+		return
+	}
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(2)
+	}
+	if cfg.DumpConfig {
+		return
+	}
+
+	logger, _ = newLogger(os.Stdout, cfg.LogFormat, cfg.LogLevel, cfg.LogPrivacy)
+	codeGen, _ = NewCodeGenerator(cfg.CodeFormat, cfg.CodeLength)
+
+	if historySize > 0 {
+		serverCapabilities = append(serverCapabilities, protocol.CapHistory)
+	}
+
+	// Постоянные комнаты переживают перезапуск, если задан файл
+	if cfg.Store != "" {
+		fileStore, err := NewFileStore(cfg.Store)
+		if err != nil {
+			fmt.Println("Store error:", err)
+			return
+		}
+		store = fileStore
+		logger.Info("store_loaded", "rooms", store.Count(), "path", cfg.Store)
+	}
+	defer func() {
+		if err := store.Close(); err != nil {
+			logger.Error("store_close_failed", "error", err)
+		}
+	}()
+
 	// ==========================================
-	// ШАГ 1: Создаём слушатель
+	// ШАГ 2: Создаём слушатель
 	// ==========================================
 
-	listener, err := net.Listen("tcp", "0.0.0.0:8080")
+	listener, err := net.Listen("tcp", cfg.Listen)
 	if err != nil {
 		fmt.Println("Error:", err)
 		return
 	}
 	defer listener.Close()
 
+	var tlsConfig *tls.Config
+	var fingerprint string
+	if cfg.TLS {
+		tlsConfig, err = loadTLSConfig(cfg.TLSCert, cfg.TLSKey)
+		if err != nil {
+			fmt.Println("TLS error:", err)
+			return
+		}
+
+		fingerprint, err = certFingerprint(tlsConfig)
+		if err != nil {
+			fmt.Println("TLS error:", err)
+			return
+		}
+
+		// Оборачиваем обычный слушатель в TLS
+		listener = tls.NewListener(listener, tlsConfig)
+		serverCapabilities = append(serverCapabilities, protocol.CapTLS)
+	}
+
 	fmt.Println("╔════════════════════════════════════╗")
-	fmt.Println("║     SERVER RUNNING (port 8080)     ║")
+	fmt.Println("║           SERVER RUNNING           ║")
 	fmt.Println("╚════════════════════════════════════╝")
+	fmt.Println("Listening on", cfg.Listen)
+	if fingerprint != "" {
+		fmt.Println("")
+		fmt.Println("TLS enabled. Certificate fingerprint (SHA-256):")
+		fmt.Println("  " + fingerprint)
+	}
+	// Слушатели, которые закрываются при остановке (shutdown.go)
+	listeners := []net.Listener{listener}
+
+	if cfg.WebSocket != "" {
+		wsListener, err := net.Listen("tcp", cfg.WebSocket)
+		if err != nil {
+			fmt.Println("WebSocket error:", err)
+			return
+		}
+		listeners = append(listeners, wsListener)
+
+		fmt.Println("")
+		fmt.Println("WebSocket gateway on", cfg.WebSocket+"/ws")
+
+		// WebSocket слушает отдельно, но комнаты у всех общие
+		go func() {
+			if err := serveWebSocket(wsListener, tlsConfig); err != nil && !isStopping() {
+				logger.Error("websocket_failed", "error", err)
+			}
+		}()
+	}
+	if cfg.Metrics != "" {
+		fmt.Println("")
+		fmt.Println("Metrics on", cfg.Metrics+"/metrics")
+
+		go func() {
+			if err := serveMetrics(cfg.Metrics); err != nil {
+				logger.Error("metrics_failed", "error", err)
+			}
+		}()
+	}
+	if cfg.AdminSocket != "" {
+		fmt.Println("")
+		fmt.Println("Admin socket:", cfg.AdminSocket)
+
+		go func() {
+			if err := serveAdmin(cfg.AdminSocket); err != nil {
+				logger.Error("admin_socket_failed", "error", err)
+			}
+		}()
+	}
 	fmt.Println("")
 	fmt.Println("Waiting for connections...")
 	fmt.Println("")
 
+	// SIGINT/SIGTERM закрывают слушатели — цикл ниже завершится
+	go handleSignals(listeners...)
+
 	// ==========================================
-	// ШАГ 2: Бесконечный цикл — принимаем клиентов
+	// ШАГ 3: Бесконечный цикл — принимаем клиентов
 	// ==========================================
 
 	// for {} — бесконечный цикл
@@ -36,7 +156,10 @@ func main() {
 		// Accept ждёт нового подключения
 		conn, err := listener.Accept()
 		if err != nil {
-			fmt.Println("Connection error:", err)
+			if isStopping() {
+				break
+			}
+			logger.Warn("accept_failed", "error", err)
 			continue // пропускаем ошибку, ждём следующего
 		}
 
@@ -49,6 +172,48 @@ func main() {
 		// С "go":   сервер обслуживает всех одновременно
 		go handleClient(conn)
 	}
+
+	// ==========================================
+	// ШАГ 4: Остановка — предупреждаем клиентов и отключаем
+	// ==========================================
+
+	drain(cfg.ShutdownTimeout, cfg.RestartHint)
+	logger.Info("shutdown_complete")
+}
+
+// serverCapabilities — что умеет этот сервер
+// Клиенту в hello уходит пересечение с его списком
+var serverCapabilities = []string{protocol.CapHeartbeat, protocol.CapWho, protocol.CapTyping, protocol.CapDirect, protocol.CapNick}
+
+// maxMessageSize — максимальный размер тела chat (шифротекст, в байтах)
+var maxMessageSize = 32 * 1024
+
+// chatFrameOverhead — место в chat-фрейме для JSON вокруг тела
+const chatFrameOverhead = 1024
+
+// frameLimit — максимальный размер фрейма от клиента по типу.
+// Проверяется по заголовку, до чтения самого фрейма: больше этого
+// сервер не читает и не держит в памяти.
+func frameLimit(t protocol.Type) int {
+	switch t {
+	case protocol.TypeChat, protocol.TypeDirect:
+		return maxMessageSize + chatFrameOverhead
+	case protocol.TypeWho:
+		// От клиента — только запрос (пустой или с одним именем);
+		// список шлёт сервер
+		return 128
+	}
+	return protocol.PayloadLimit(t)
+}
+
+// readFrame читает следующий фрейм клиента: не больше frameLimit
+// и только той версии протокола, о которой договорились в handshake
+func readFrame(reader *bufio.Reader, version uint8) (protocol.Frame, error) {
+	frame, err := protocol.ReadFrameLimited(reader, frameLimit)
+	if err != nil {
+		return frame, err
+	}
+	return frame, frame.CheckVersion(version)
 }
 
 // handleClient обрабатывает одного клиента
@@ -56,139 +221,501 @@ func main() {
 func handleClient(conn net.Conn) {
 	defer conn.Close()
 
+	// Во время остановки новых клиентов не обслуживаем
+	if !conns.Add(conn) {
+		return
+	}
+	defer conns.Remove(conn)
+
+	// Слишком много соединений с одного адреса (ratelimit.go)
+	ip := remoteIP(conn)
+	if !limiter.Connect(ip) {
+		logger.Warn("too_many_connections", "remote_addr", ip, "limit", maxConnsPerIP)
+		sendError(conn, protocol.ErrTooManyConnections, "Too many connections from your address")
+		return
+	}
+	defer limiter.Disconnect(ip)
+
+	metricConnections.Inc()
+	defer metricConnections.Dec()
+
 	reader := bufio.NewReader(conn)
 
 	// ==========================================
-	// ШАГ 1: Получаем username
+	// ШАГ 1: Handshake — версия протокола и возможности
 	// ==========================================
 
-	username, err := reader.ReadString('\n')
-	if err != nil {
-		fmt.Println("Error reading username:", err)
+	// До входа в комнату — общий таймаут на каждый фрейм (heartbeat.go)
+	extendDeadline(conn, loginTimeout)
+
+	var hello protocol.Hello
+	if err := protocol.Expect(reader, protocol.TypeHello, &hello); err != nil {
+		logger.Warn("bad_hello", "remote_addr", conn.RemoteAddr(), "error", err)
+		if errors.Is(err, protocol.ErrFrameTooLarge) {
+			sendError(conn, protocol.ErrOversizedFrame, err.Error())
+		} else {
+			sendError(conn, protocol.ErrBadRequest, "Expected hello")
+		}
+		return
+	}
+	if err := hello.CheckLimits(); err != nil {
+		logger.Warn("bad_hello", "remote_addr", conn.RemoteAddr(), "error", err)
+		sendError(conn, protocol.ErrFieldTooLong, err.Error())
 		return
 	}
-	username = strings.TrimSpace(username)
 
-	fmt.Printf("→ New connection: %s\n", username)
+	// Имя проверяем сразу: с ним клиент входит в любую комнату (username.go)
+	username := strings.TrimSpace(hello.Username)
+	if err := protocol.CheckUsername(username); err != nil {
+		logger.Warn("bad_username", "remote_addr", conn.RemoteAddr(), "error", err)
+		sendError(conn, protocol.ErrBadUsername, err.Error())
+		return
+	}
 
-	// ==========================================
-	// ШАГ 2: Получаем команду (create или connect)
-	// ==========================================
+	// Проверяем что версии клиента и сервера пересекаются
+	version, err := protocol.Negotiate(hello.MinVersion, hello.Version)
+	if err != nil {
+		sendError(conn, protocol.ErrIncompatibleVersion, err.Error())
+		logger.Warn("incompatible_version", "remote_addr", conn.RemoteAddr(), "error", err)
+		return
+	}
 
-	command, err := reader.ReadString('\n')
+	// Отвечаем своим hello: выбранная версия + общие возможности
+	capabilities := protocol.CommonCapabilities(serverCapabilities, hello.Capabilities)
+	err = protocol.Send(conn, protocol.TypeHello, protocol.Hello{
+		Version:      version,
+		MinVersion:   protocol.MinVersion,
+		Capabilities: capabilities,
+		CodeFormat:   codeGen.Describe(),
+		MaxMessage:   maxMessageSize,
+	})
 	if err != nil {
-		fmt.Println("Error reading command:", err)
+		logger.Warn("write_failed", "remote_addr", conn.RemoteAddr(), "error", err)
 		return
 	}
-	command = strings.TrimSpace(command)
 
-	var room *Room
-	var client *Client
+	logger.Info("connected", "user", username, "remote_addr", conn.RemoteAddr(), "protocol", version)
 
 	// ==========================================
-	// ШАГ 3: Обрабатываем команду
+	// ШАГ 2: Получаем команду (create или join)
 	// ==========================================
 
-	if command == "create" {
-		// CREATE — создаём новую комнату
+	var room *Room
+	client := NewClient(conn, username, capabilities)
 
-		// Вызываем функцию из room.go
-		code := CreateRoom()
+	// Ключ для личных сообщений (direct.go)
+	if protocol.HasCapability(capabilities, protocol.CapDirect) {
+		client.PublicKey = hello.PublicKey
+	}
 
-		// Получаем созданную комнату
-		room = GetRoom(code)
+	// Перед выходом ждём, пока писатель допишет очередь (например,
+	// последнюю ошибку) — иначе conn.Close выше оборвёт её
+	defer func() {
+		client.Close()
+		<-client.Flushed()
+	}()
+
+	// Пока клиент не попал в комнату — принимаем команды.
+	// Ошибки вроде "комната не найдена" или "неверный пароль" не рвут
+	// соединение: клиент может исправиться и попробовать ещё раз.
+	for room == nil {
+		extendDeadline(conn, loginTimeout)
+		request, err := readFrame(reader, version)
+		if err != nil {
+			logger.Info("disconnected", "user", username, "remote_addr", conn.RemoteAddr(), "error", err)
+			if errors.Is(err, protocol.ErrFrameTooLarge) {
+				client.Send(errorFrame(protocol.ErrOversizedFrame, err.Error()))
+			}
+			if errors.Is(err, protocol.ErrUnexpectedVersion) {
+				client.Send(errorFrame(protocol.ErrIncompatibleVersion, err.Error()))
+			}
+			return
+		}
+
+		// ==========================================
+		// ШАГ 3: Обрабатываем команду
+		// ==========================================
+
+		switch request.Type {
+		case protocol.TypeCreate:
+			room, err = createRoom(client, request)
+		case protocol.TypeJoin:
+			room, err = joinRoom(client, request)
+		default:
+			err = &protocol.Error{Code: protocol.ErrUnknownCommand, Message: "Unknown command. Use 'create' or 'join'"}
+		}
+
+		var protoErr *protocol.Error
+		if errors.As(err, &protoErr) {
+			// Ошибка для клиента — сообщаем и ждём следующую команду
+			// (целиком, вместе с retry_after)
+			if f, err := protocol.NewFrame(protocol.TypeError, protoErr); err == nil {
+				client.Send(f)
+			}
 
-		// Создаём объект клиента
-		client = &Client{
-			Conn:     conn,
-			Username: username,
+			// Кроме слишком длинных полей: нормальный клиент их не шлёт
+			if protoErr.Code == protocol.ErrFieldTooLong {
+				logger.Warn("field_too_long", "user", username, "remote_addr", conn.RemoteAddr(), "error", protoErr.Message)
+				return
+			}
+			continue
+		}
+		if err != nil {
+			logger.Error("request_failed", "user", username, "remote_addr", conn.RemoteAddr(), "error", err)
+			return
 		}
+	}
+	metricJoins.Inc()
 
-		// Добавляем клиента в комнату
-		room.AddClient(client)
+	// Имя могло смениться в join (новое имя или суффикс к дубликату)
+	username = client.Username
 
-		// Отправляем код клиенту
-		// Формат: "CODE:12345\n"
-		conn.Write([]byte("CODE:" + code + "\n"))
+	// Heartbeat: пингуем и ждём ответа не дольше idleTimeout.
+	// Старых клиентов без heartbeat не торопим.
+	heartbeat := protocol.HasCapability(capabilities, protocol.CapHeartbeat)
+	if heartbeat {
+		client.startHeartbeat()
+	}
 
-		fmt.Printf("✓ Room created: %s by %s\n", code, username)
+	// ==========================================
+	// ШАГ 4: Режим чата — читаем и рассылаем сообщения
+	// ==========================================
 
-	} else if command == "connect" {
-		// CONNECT — подключаемся к существующей комнате
+	for {
+		if heartbeat {
+			extendDeadline(conn, idleTimeout)
+		} else {
+			extendDeadline(conn, 0)
+		}
 
-		// Читаем код от клиента
-		code, err := reader.ReadString('\n')
+		frame, err := readFrame(reader, version)
 		if err != nil {
-			fmt.Println("Error reading code:", err)
+			// Клиент отключился, замолчал или прислал фрейм, который
+			// мы не читаем (слишком большой или чужой версии)
+			text := username + " left the room"
+			if isTimeout(err) {
+				text = username + " lost connection"
+				logger.Info("idle_timeout", "room", room.Code, "user", username, "remote_addr", conn.RemoteAddr(), "timeout", idleTimeout)
+			}
+			if errors.Is(err, protocol.ErrFrameTooLarge) {
+				logger.Warn("frame_too_large", "room", room.Code, "user", username, "remote_addr", conn.RemoteAddr(), "error", err)
+				client.Send(errorFrame(protocol.ErrOversizedFrame, err.Error()))
+			}
+			if errors.Is(err, protocol.ErrUnexpectedVersion) {
+				logger.Warn("unexpected_version", "room", room.Code, "user", username, "remote_addr", conn.RemoteAddr(), "error", err)
+				client.Send(errorFrame(protocol.ErrIncompatibleVersion, err.Error()))
+			}
+			logger.Info("room_left", "room", room.Code, "user", username, "remote_addr", conn.RemoteAddr())
+
+			// Удаляем из комнаты. Если клиента там уже нет — его место
+			// заняло новое соединение того же пользователя (resume.go)
+			if !room.RemoveClient(client) {
+				return
+			}
+			room.suspendResume(client)
+			metricLeaves.Inc()
+
+			// Уведомляем остальных
+			room.Broadcast(systemFrame(protocol.EventLeft, username, text), client)
+
+			// Если комната пустая — удаляем её, как только в неё
+			// некому будет вернуться (постоянные комнаты остаются
+			// ждать своих участников)
+			removeIfAbandoned(room)
+
 			return
 		}
-		code = strings.TrimSpace(code)
 
-		// Ищем комнату
-		room = GetRoom(code)
+		switch frame.Type {
+		case protocol.TypeChat:
+			// обрабатываем ниже
+		case protocol.TypeKnock:
+			answerKnock(client, room, frame)
+			continue
+		case protocol.TypePing:
+			answerPing(client, frame)
+			continue
+		case protocol.TypeWho:
+			answerWho(client, room, frame)
+			continue
+		case protocol.TypeTyping:
+			relayTyping(client, room, frame)
+			continue
+		case protocol.TypeDirect:
+			relayDirect(client, room, frame)
+			continue
+		case protocol.TypeLeave:
+			// Клиент уходит сам (/leave, /quit): место в комнате
+			// держать незачем, имя сразу свободно (resume.go)
+			room.revokeResume(username)
+			continue
+		case protocol.TypeNick:
+			// Новое имя ставится в client.Username (username.go)
+			changeNick(client, room, frame)
+			username = client.Username
+			continue
+		default:
+			// В том числе pong: он нужен только чтобы продлить дедлайн
+			continue
+		}
 
-		if room == nil {
-			// Комната не найдена
-			conn.Write([]byte("ERROR:Room not found\n"))
-			fmt.Printf("✗ Room not found: %s (requested by %s)\n", code, username)
-			return
+		var chat protocol.Chat
+		if err := frame.Decode(&chat); err != nil {
+			continue
+		}
+		if len(chat.Body) > maxMessageSize {
+			client.Send(errorFrame(protocol.ErrMessageTooLarge,
+				fmt.Sprintf("Message is too large (limit %d bytes)", maxMessageSize)))
+			continue
 		}
 
-		// Создаём объект клиента
-		client = &Client{
-			Conn:     conn,
-			Username: username,
+		// Лимиты сообщений и байт (ratelimit.go)
+		if !throttleMessage(client, room, len(chat.Body)) {
+			continue
 		}
 
-		// Добавляем в комнату
-		room.AddClient(client)
+		// Имя отправителя ставит сервер — клиент не может подделать
+		chat = protocol.Chat{From: username, Body: chat.Body}
 
-		// Отправляем подтверждение
-		conn.Write([]byte("OK:Connected to room " + code + "\n"))
+		// Рассылаем всем в комнате (кроме отправителя) и пишем в историю
+		if err := room.Relay(chat, client); err != nil {
+			continue
+		}
 
-		// Уведомляем остальных в комнате
-		room.Broadcast(fmt.Sprintf(">>> %s joined the room\n", username), client)
+		// Тело сообщения попадает в лог только без -log-privacy
+		logger.Debug("message_relayed", "room", room.Code, "user", username, "bytes", len(chat.Body), "body", chat.Body)
+	}
+}
 
-		fmt.Printf("✓ %s joined room: %s\n", username, code)
+// ============================================================
+// КОМАНДЫ CREATE И JOIN
+// ============================================================
+//
+// Ошибки типа *protocol.Error уходят клиенту, остальные рвут соединение.
+
+// createRoom создаёт новую комнату, владелец — client
+func createRoom(client *Client, request protocol.Frame) (*Room, error) {
+	var create protocol.Create
+	if err := request.Decode(&create); err != nil {
+		return nil, &protocol.Error{Code: protocol.ErrBadRequest, Message: "Invalid create request"}
+	}
+	if err := create.CheckLimits(); err != nil {
+		return nil, err
+	}
 
-	} else {
-		// Неизвестная команда
-		conn.Write([]byte("ERROR:Unknown command. Use 'create' or 'connect'\n"))
-		return
+	// Создавать комнаты в цикле нельзя (ratelimit.go)
+	if ok, wait := limiter.AllowCreate(remoteIP(client.Conn)); !ok {
+		logger.Warn("create_rate_limited", "user", client.Username, "remote_addr", client.Conn.RemoteAddr())
+		return nil, rateLimited("Too many rooms created", wait)
 	}
 
-	// ==========================================
-	// ШАГ 4: Режим чата — читаем и рассылаем сообщения
-	// ==========================================
+	settings := RoomSettings{
+		Persistent: create.Persistent,
+		Knock:      create.Knock,
+	}
 
-	for {
-		message, err := reader.ReadString('\n')
+	// Пароль храним только в виде соли + хеша
+	if create.Secret != "" {
+		hash, salt, err := hashSecret(create.Secret)
 		if err != nil {
-			// Клиент отключился
-			fmt.Printf("← %s disconnected from room %s\n", username, room.Code)
+			return nil, err
+		}
+		settings.SecretHash = hash
+		settings.SecretSalt = salt
+	}
+
+	// Токен владельца: по нему создатель узнаётся при повторном входе
+	ownerToken, err := newToken()
+	if err != nil {
+		return nil, err
+	}
+	settings.OwnerTokenHash = hashToken(ownerToken)
 
-			// Удаляем из комнаты
-			room.RemoveClient(client)
+	// Вызываем функцию из room.go
+	code, err := CreateRoom(client.Username, settings)
+	if err == errTooManyRooms {
+		return nil, &protocol.Error{Code: protocol.ErrServerFull, Message: "The server has reached its room limit, try again later"}
+	}
+	if err != nil {
+		logger.Error("room_create_failed", "user", client.Username, "error", err)
+		return nil, &protocol.Error{Code: protocol.ErrInternal, Message: "Could not create room"}
+	}
 
-			// Уведомляем остальных
-			room.Broadcast(fmt.Sprintf("<<< %s left the room\n", username), client)
+	// Получаем созданную комнату
+	room := GetRoom(code)
+	client.Owner = true
 
-			// Если комната пустая — удаляем её
-			if room.GetClientCount() == 0 {
-				DeleteRoom(room.Code)
-				fmt.Printf("✗ Room deleted: %s (empty)\n", room.Code)
-			}
+	// Добавляем клиента в комнату и отправляем ему код
+	newMember, err := room.Join(client, protocol.Ack{Message: "Room created", OwnerToken: ownerToken})
+	if err != nil {
+		room.RemoveClient(client)
+		return nil, err
+	}
+	if newMember {
+		saveRoom(room)
+	}
 
-			return
+	logger.Info("room_created", "room", code, "user", client.Username, "remote_addr", client.Conn.RemoteAddr(),
+		"persistent", settings.Persistent, "password", settings.SecretHash != "", "knock", settings.Knock)
+	return room, nil
+}
+
+// failJoin записывает неудачный вход и возвращает ошибку для клиента
+//
+// bad_secret выдаёт, что комната с таким кодом есть, — без этого клиент
+// не узнал бы, что нужно спросить пароль. Поэтому обе неудачи стоят
+// одинаково: одна и та же пауза и бан в guard, и проверять коды
+// через bad_secret не быстрее, чем подбирать их вслепую.
+func failJoin(client *Client, ip, code string, err *protocol.Error) error {
+	guard.Fail(ip, code)
+	metricFailedJoins.Inc()
+	logger.Warn("join_failed", "reason", err.Code, "room", code, "user", client.Username, "remote_addr", client.Conn.RemoteAddr())
+	return err
+}
+
+// joinRoom добавляет client в существующую комнату
+func joinRoom(client *Client, request protocol.Frame) (*Room, error) {
+	var join protocol.Join
+	if err := request.Decode(&join); err != nil {
+		return nil, &protocol.Error{Code: protocol.ErrBadRequest, Message: "Invalid join request"}
+	}
+	if err := join.CheckLimits(); err != nil {
+		return nil, err
+	}
+
+	// Новое имя вместо указанного в hello (например, после username_taken)
+	if join.Username != "" {
+		if err := protocol.CheckUsername(join.Username); err != nil {
+			return nil, err
+		}
+		client.setName(join.Username)
+	}
+
+	code := NormalizeCode(join.Code)
+	username := client.Username
+	ip := remoteIP(client.Conn)
+	client.MemberToken = join.MemberToken
+
+	// Возвращение после обрыва связи: пароль и knock не нужны (resume.go)
+	if join.ResumeToken != "" && IsValidCode(code) {
+		if room := GetRoom(code); room != nil && room.checkResume(username, join.ResumeToken) {
+			return resumeRoom(client, room, join)
+		}
+	}
+
+	// Защита от перебора: слишком много неудач с этого IP (guard.go)
+	if ok, wait := guard.Allow(ip); !ok {
+		seconds := int(wait.Seconds()) + 1
+		return nil, &protocol.Error{
+			Code:       protocol.ErrTooManyAttempts,
+			Message:    fmt.Sprintf("Too many failed attempts, try again in %d s", seconds),
+			RetryAfter: seconds,
+		}
+	}
+
+	// Ищем комнату (код неверного формата точно не найдётся)
+	var room *Room
+	if IsValidCode(code) {
+		room = GetRoom(code)
+	}
+
+	if room == nil {
+		return nil, failJoin(client, ip, code, &protocol.Error{Code: protocol.ErrRoomNotFound, Message: "Room not found"})
+	}
+
+	// Пароль проверяется для всех, включая владельца
+	if room.Settings.SecretHash != "" &&
+		!checkSecret(join.Secret, room.Settings.SecretHash, room.Settings.SecretSalt) {
+		return nil, failJoin(client, ip, code, &protocol.Error{Code: protocol.ErrBadSecret, Message: "Wrong room password"})
+	}
+	guard.Success(ip)
+
+	client.Owner = checkToken(join.OwnerToken, room.Settings.OwnerTokenHash)
+
+	// Не спрашиваем владельца про имя, которое всё равно занято
+	if duplicateNames == "reject" && room.NameTaken(username) {
+		return nil, errUsernameTaken
+	}
+
+	// Knock: ждём решения владельца
+	if room.Settings.Knock && !client.Owner {
+		client.Send(systemFrame(protocol.EventWaiting, username, "Waiting for the room owner to let you in..."))
+
+		accepted, err := room.Knock(username)
+		switch {
+		case err == errOwnerOffline:
+			return nil, &protocol.Error{Code: protocol.ErrOwnerOffline, Message: "The room owner is offline, try again later"}
+		case err != nil:
+			return nil, &protocol.Error{Code: protocol.ErrJoinRejected, Message: err.Error()}
+		case !accepted:
+			logger.Info("join_rejected", "room", code, "user", username, "remote_addr", client.Conn.RemoteAddr())
+			return nil, &protocol.Error{Code: protocol.ErrJoinRejected, Message: "The room owner did not let you in"}
 		}
+	}
+
+	// Добавляем в комнату, отправляем подтверждение и историю
+	newMember, err := room.Join(client, protocol.Ack{Message: "Connected to room " + code})
+	if err != nil {
+		room.RemoveClient(client)
+		return nil, err
+	}
+	if newMember {
+		saveRoom(room)
+	}
+	username = client.Username
+
+	// Уведомляем остальных в комнате
+	room.Broadcast(systemFrame(protocol.EventJoined, username, username+" joined the room"), client)
+
+	logger.Info("room_joined", "room", code, "user", username, "remote_addr", client.Conn.RemoteAddr(), "owner", client.Owner)
+	return room, nil
+}
+
+// answerKnock обрабатывает решение владельца по запросу на вход
+func answerKnock(client *Client, room *Room, frame protocol.Frame) {
+	if !client.Owner {
+		client.Send(errorFrame(protocol.ErrBadRequest, "Only the room owner can answer join requests"))
+		return
+	}
+
+	var knock protocol.Knock
+	if err := frame.Decode(&knock); err != nil {
+		return
+	}
+
+	if !room.AnswerKnock(knock.Username, knock.Accept) {
+		client.Send(errorFrame(protocol.ErrBadRequest, "No join request from "+knock.Username))
+	}
+}
+
+// ============================================================
+// ВСПОМОГАТЕЛЬНЫЕ ФУНКЦИИ ДЛЯ ФРЕЙМОВ
+// ============================================================
 
-		// Формируем сообщение с именем отправителя
-		formattedMessage := fmt.Sprintf("[%s] %s", username, message)
+// sendError отправляет клиенту фрейм ошибки
+func sendError(conn net.Conn, code, message string) {
+	protocol.Send(conn, protocol.TypeError, protocol.Error{Code: code, Message: message})
+}
 
-		// Рассылаем всем в комнате (кроме отправителя)
-		room.Broadcast(formattedMessage, client)
+// errorFrame собирает фрейм ошибки (для client.Send)
+func errorFrame(code, message string) protocol.Frame {
+	f, _ := protocol.NewFrame(protocol.TypeError, protocol.Error{Code: code, Message: message})
+	return f
+}
 
-		// Логируем на сервере
-		fmt.Printf("[%s] %s: %s", room.Code, username, message)
+// saveRoom сохраняет изменения комнаты в store
+func saveRoom(room *Room) {
+	if err := store.Update(room); err != nil {
+		logger.Error("room_save_failed", "room", room.Code, "error", err)
 	}
 }
+
+// systemFrame собирает системное уведомление (joined/left)
+func systemFrame(event, username, text string) protocol.Frame {
+	f, _ := protocol.NewFrame(protocol.TypeSystem, protocol.System{
+		Event:    event,
+		Username: username,
+		Text:     text,
+	})
+	return f
+}
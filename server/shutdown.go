@@ -0,0 +1,172 @@
+package main
+
+// ============================================================
+// ОСТАНОВКА СЕРВЕРА
+// ============================================================
+//
+// По SIGINT/SIGTERM сервер:
+//   1. перестаёт принимать подключения (TCP и WebSocket)
+//   2. отправляет всем во всех комнатах system "shutdown"
+//      (с подсказкой, через сколько переподключаться, если задан -restart-hint)
+//   3. ждёт, пока очереди отправки допишутся, и закрывает соединения —
+//      всё вместе не дольше -shutdown-timeout
+//   4. сохраняет store (defer store.Close() в main)
+//
+// Второй сигнал во время остановки завершает процесс сразу.
+
+import (
+	"net"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"messenger-protocol"
+)
+
+var (
+	// stopping закрывается в начале остановки
+	stopping = make(chan struct{})
+
+	// errStopping — ответ тем, кто ждал в knock-комнате
+	errStopping = &protocol.Error{Code: protocol.ErrJoinRejected, Message: "The server is shutting down"}
+
+	// conns — все открытые клиентские соединения
+	conns = &connSet{conns: make(map[net.Conn]bool)}
+)
+
+// isStopping сообщает, идёт ли остановка
+func isStopping() bool {
+	select {
+	case <-stopping:
+		return true
+	default:
+		return false
+	}
+}
+
+// handleSignals ждёт SIGINT/SIGTERM и закрывает слушатели,
+// чтобы цикл Accept в main завершился
+func handleSignals(listeners ...net.Listener) {
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+
+	sig := <-signals
+	logger.Info("shutdown_started", "signal", sig.String())
+
+	conns.mu.Lock()
+	close(stopping)
+	conns.mu.Unlock()
+
+	for _, l := range listeners {
+		l.Close()
+	}
+
+	sig = <-signals
+	logger.Warn("shutdown_forced", "signal", sig.String())
+	os.Exit(1)
+}
+
+// drain предупреждает клиентов и закрывает соединения
+func drain(timeout, restartHint time.Duration) {
+	deadline := time.Now().Add(timeout)
+
+	text := "The server is shutting down"
+	if restartHint > 0 {
+		text = "The server is restarting"
+	}
+	notice, _ := protocol.NewFrame(protocol.TypeSystem, protocol.System{
+		Event:      protocol.EventShutdown,
+		Text:       text,
+		RetryAfter: int(restartHint.Seconds()),
+	})
+
+	// Уведомление встаёт в очередь каждого клиента после всего,
+	// что туда уже попало; Close дописывает очередь и закрывает соединение
+	var clients []*Client
+	for _, room := range store.List() {
+		room.Broadcast(notice, nil)
+		clients = append(clients, room.ClientList()...)
+	}
+	for _, client := range clients {
+		client.Close()
+	}
+
+	// Ждём, пока писатели допишут очереди
+	for _, client := range clients {
+		select {
+		case <-client.Flushed():
+		case <-time.After(time.Until(deadline)):
+			logger.Warn("shutdown_flush_timeout", "user", client.Name(), "remote_addr", client.Conn.RemoteAddr())
+		}
+	}
+
+	// Остальные (ещё не вошедшие в комнату или зависшие) — закрываем сразу
+	closed := conns.CloseAll()
+
+	if conns.Wait(time.Until(deadline)) {
+		logger.Info("shutdown_drained", "connections", closed)
+	} else {
+		logger.Warn("shutdown_timeout", "connections", closed)
+	}
+}
+
+// ============================================================
+// УЧЁТ СОЕДИНЕНИЙ
+// ============================================================
+
+type connSet struct {
+	mu    sync.Mutex
+	conns map[net.Conn]bool
+	wg    sync.WaitGroup
+}
+
+// Add регистрирует соединение; false — сервер уже останавливается
+func (s *connSet) Add(conn net.Conn) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if isStopping() {
+		return false
+	}
+	s.conns[conn] = true
+	s.wg.Add(1)
+	return true
+}
+
+// Remove вызывается, когда handleClient закончил работу
+func (s *connSet) Remove(conn net.Conn) {
+	s.mu.Lock()
+	delete(s.conns, conn)
+	s.mu.Unlock()
+
+	s.wg.Done()
+}
+
+// CloseAll закрывает все соединения и возвращает их число
+func (s *connSet) CloseAll() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for conn := range s.conns {
+		conn.Close()
+	}
+	return len(s.conns)
+}
+
+// Wait ждёт завершения всех handleClient, но не дольше timeout
+func (s *connSet) Wait(timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
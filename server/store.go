@@ -0,0 +1,109 @@
+package main
+
+// ============================================================
+// ХРАНИЛИЩЕ КОМНАТ
+// ============================================================
+//
+// RoomStore — интерфейс, через который CreateRoom/GetRoom/DeleteRoom
+// работают с комнатами. Реализации:
+//   - memoryStore — обычная map в памяти (комнаты живут до перезапуска)
+//   - fileStore   — то же самое + JSON-файл на диске (filestore.go)
+
+import (
+	"errors"
+	"sync"
+)
+
+// ErrRoomExists — код уже занят другой комнатой
+var ErrRoomExists = errors.New("room already exists")
+
+// RoomStore хранит все комнаты сервера
+type RoomStore interface {
+	// Create добавляет новую комнату (ErrRoomExists если код занят)
+	Create(room *Room) error
+
+	// Get возвращает комнату по коду (или nil если не найдена)
+	Get(code string) *Room
+
+	// Update сохраняет изменения настроек комнаты
+	Update(room *Room) error
+
+	// Delete удаляет комнату
+	Delete(code string) error
+
+	// List возвращает все комнаты
+	List() []*Room
+
+	// Count возвращает количество комнат
+	Count() int
+
+	// Close сбрасывает всё на диск и освобождает ресурсы
+	Close() error
+}
+
+// ============================================================
+// memoryStore — комнаты в памяти
+// ============================================================
+
+type memoryStore struct {
+	mu    sync.Mutex       // мьютекс для безопасного доступа к rooms
+	rooms map[string]*Room // ключ: код комнаты, значение: комната
+}
+
+// NewMemoryStore создаёт пустое хранилище в памяти
+func NewMemoryStore() *memoryStore {
+	return &memoryStore{rooms: make(map[string]*Room)}
+}
+
+func (s *memoryStore) Create(room *Room) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.rooms[room.Code] != nil {
+		return ErrRoomExists
+	}
+	s.rooms[room.Code] = room
+	return nil
+}
+
+func (s *memoryStore) Get(code string) *Room {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.rooms[code]
+}
+
+func (s *memoryStore) Update(room *Room) error {
+	// В памяти комната и так хранится по указателю — сохранять нечего
+	return nil
+}
+
+func (s *memoryStore) Delete(code string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.rooms, code)
+	return nil
+}
+
+func (s *memoryStore) List() []*Room {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	list := make([]*Room, 0, len(s.rooms))
+	for _, room := range s.rooms {
+		list = append(list, room)
+	}
+	return list
+}
+
+func (s *memoryStore) Count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.rooms)
+}
+
+func (s *memoryStore) Close() error {
+	return nil
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadTLSConfigGeneratesOnce(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "server.crt")
+	keyFile := filepath.Join(dir, "server.key")
+
+	// Первый запуск: файлов нет — сертификат создаётся
+	cfg, err := loadTLSConfig(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, err := certFingerprint(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("key file mode = %v, want 0600", info.Mode().Perm())
+	}
+
+	// Отпечаток — SHA-256 от DER из файла: его клиент и запоминает
+	data, err := os.ReadFile(certFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		t.Fatal("no PEM block in the certificate file")
+	}
+	sum := sha256.Sum256(block.Bytes)
+	if want := hex.EncodeToString(sum[:]); first != want {
+		t.Errorf("fingerprint = %s, want %s", first, want)
+	}
+
+	// Следующий запуск: тот же сертификат, иначе клиенты с TOFU
+	// увидят смену сертификата
+	cfg, err = loadTLSConfig(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := certFingerprint(cfg); again != first {
+		t.Errorf("fingerprint changed between runs: %s, then %s", first, again)
+	}
+}
+
+func TestLoadTLSConfigMissingKey(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "server.crt")
+	keyFile := filepath.Join(dir, "server.key")
+
+	if _, err := loadTLSConfig(certFile, keyFile); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(keyFile); err != nil {
+		t.Fatal(err)
+	}
+
+	// Один файл без другого — ошибка, а не новый сертификат поверх старого
+	if _, err := loadTLSConfig(certFile, keyFile); err == nil {
+		t.Error("loaded a certificate without its key")
+	}
+	if fileExists(keyFile) {
+		t.Error("a new key was generated next to the old certificate")
+	}
+}
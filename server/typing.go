@@ -0,0 +1,45 @@
+package main
+
+// ============================================================
+// ИНДИКАТОР "ПЕЧАТАЕТ…"
+// ============================================================
+//
+// Клиент с возможностью "typing" сообщает, что начал или перестал
+// печатать. Сервер подставляет имя и рассылает событие остальным
+// участникам с той же возможностью:
+//   - в историю и офлайн-очереди не попадает
+//   - текста не содержит — только active: true/false
+//   - лишние события (чаще -typing-rate в секунду) молча отбрасываются
+
+import "messenger-protocol"
+
+// Лимит событий typing на клиента (флаги -typing-rate и -typing-burst)
+var (
+	typingRate  = 1.0
+	typingBurst = 3
+)
+
+// relayTyping рассылает событие typing от client остальным в комнате
+func relayTyping(client *Client, room *Room, frame protocol.Frame) {
+	if !protocol.HasCapability(client.Capabilities, protocol.CapTyping) {
+		return
+	}
+
+	var typing protocol.Typing
+	if err := frame.Decode(&typing); err != nil {
+		return
+	}
+	if !client.limits.allowTyping() {
+		return
+	}
+
+	// Имя ставит сервер, как и в chat
+	f, err := protocol.NewFrame(protocol.TypeTyping, protocol.Typing{
+		Username: client.Username,
+		Active:   typing.Active,
+	})
+	if err != nil {
+		return
+	}
+	room.BroadcastTo(f, client, protocol.CapTyping)
+}
@@ -0,0 +1,182 @@
+package main
+
+// ============================================================
+// ИМЕНА ПОЛЬЗОВАТЕЛЕЙ
+// ============================================================
+//
+// Правила для имени (длина, символы, зарезервированные слова) —
+// в protocol.CheckUsername: клиент проверяет то же самое у себя.
+// Имя проверяется в hello и в join (если клиент прислал новое).
+//
+// В одной комнате имена уникальны без учёта регистра. Занятым
+// считается и имя клиента, который оборвался и ещё может вернуться
+// (resume.go). Что делать с дубликатом — решает -duplicate-names:
+//   - reject: ошибка username_taken, клиент спросит другое имя
+//   - suffix: сервер сам добавит номер: alice → alice-2
+//
+// Уже в комнате имя можно сменить фреймом nick (возможность "nick").
+// Новое имя проверяется так же, суффикс не добавляется: занято — ошибка.
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"messenger-protocol"
+)
+
+// duplicateNames — "reject" или "suffix" (флаг -duplicate-names)
+var duplicateNames = "reject"
+
+var errUsernameTaken = &protocol.Error{
+	Code:    protocol.ErrUsernameTaken,
+	Message: "This username is already taken in the room, choose another one",
+}
+
+// NameTaken сообщает, занято ли имя в комнате
+func (r *Room) NameTaken(name string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.nameTaken(name)
+}
+
+// nameTaken — то же под r.mu
+func (r *Room) nameTaken(name string) bool {
+	for _, c := range r.Clients {
+		if strings.EqualFold(c.Username, name) {
+			return true
+		}
+	}
+
+	now := time.Now()
+	for username, e := range r.resumes {
+		if e.client == nil && now.Before(e.expires) && strings.EqualFold(username, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// claimName закрепляет за client его имя в комнате (под r.mu)
+//
+// В режиме suffix при совпадении меняет client.Username.
+func (r *Room) claimName(client *Client) error {
+	if !r.nameTaken(client.Username) {
+		return nil
+	}
+	if duplicateNames != "suffix" {
+		return errUsernameTaken
+	}
+
+	for n := 2; ; n++ {
+		name := suffixName(client.Username, n)
+		if !r.nameTaken(name) {
+			client.setName(name)
+			return nil
+		}
+	}
+}
+
+// suffixName: ("alice", 2) → "alice-2", укорачивая имя, чтобы
+// результат не вышел за protocol.MaxUsernameRunes
+func suffixName(name string, n int) string {
+	suffix := fmt.Sprintf("-%d", n)
+
+	runes := []rune(name)
+	if max := protocol.MaxUsernameRunes - len(suffix); len(runes) > max {
+		runes = runes[:max]
+	}
+	return string(runes) + suffix
+}
+
+// Rename меняет имя client в комнате на name
+//
+// Вместе с именем переезжают токен возврата и, в постоянной комнате,
+// участник с офлайн-очередью (если client — этот участник). Все в комнате, включая самого client, получают
+// событие renamed. Возвращает true, если комнату надо сохранить.
+func (r *Room) Rename(client *Client, name string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	old := client.Username
+	if name == old {
+		return false, nil
+	}
+
+	// Смена регистра своего же имени никому не мешает. Имя известного
+	// участника постоянной комнаты тоже занято: иначе новое имя
+	// забрало бы его офлайн-очередь.
+	if !strings.EqualFold(name, old) {
+		if _, known := r.members[name]; known || r.nameTaken(name) {
+			return false, errUsernameTaken
+		}
+	}
+
+	client.setName(name)
+	if e, ok := r.resumes[old]; ok {
+		delete(r.resumes, old)
+		r.resumes[name] = e
+	}
+	if r.Owner == old && client.Owner {
+		r.Owner = name
+	}
+
+	// Участник уносит с собой офлайн-очередь; гость под его именем — нет
+	save := false
+	if m, ok := r.members[old]; ok && client.Member {
+		delete(r.members, old)
+		m.Username = name
+		r.members[name] = m
+		save = true
+	}
+
+	f, err := protocol.NewFrame(protocol.TypeSystem, protocol.System{
+		Event:    protocol.EventRenamed,
+		Username: name,
+		Previous: old,
+		Text:     old + " is now known as " + name,
+	})
+	if err == nil {
+		r.sendAll(f, nil)
+	}
+	return save, nil
+}
+
+// changeNick обрабатывает фрейм nick от client
+func changeNick(client *Client, room *Room, frame protocol.Frame) {
+	if !protocol.HasCapability(client.Capabilities, protocol.CapNick) {
+		return
+	}
+
+	var nick protocol.Nick
+	if err := frame.Decode(&nick); err != nil {
+		client.Send(errorFrame(protocol.ErrBadRequest, "Invalid nick request"))
+		return
+	}
+	if err := nick.CheckLimits(); err != nil {
+		client.Send(errorFrame(protocol.ErrFieldTooLong, err.Error()))
+		return
+	}
+	if err := protocol.CheckUsername(nick.Username); err != nil {
+		client.Send(errorFrame(protocol.ErrBadUsername, err.Error()))
+		return
+	}
+
+	// Каждая смена имени — сообщение всей комнате, лимиты те же
+	if !throttleMessage(client, room, 0) {
+		return
+	}
+
+	old := client.Username
+	save, err := room.Rename(client, nick.Username)
+	if err != nil {
+		client.Send(errorFrame(protocol.ErrUsernameTaken, err.Error()))
+		return
+	}
+	if save {
+		saveRoom(room)
+	}
+
+	logger.Info("renamed", "room", room.Code, "user", old, "new_user", client.Username, "remote_addr", client.Conn.RemoteAddr())
+}
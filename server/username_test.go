@@ -0,0 +1,82 @@
+package main
+
+import (
+	"io"
+	"net"
+	"path/filepath"
+	"testing"
+)
+
+// withStore временно подменяет хранилище комнат
+func withStore(t *testing.T, s RoomStore) {
+	old := store
+	store = s
+	t.Cleanup(func() { store = old })
+}
+
+// readingClient — клиент, чьи фреймы кто-то читает (очередь не переполнится)
+func readingClient(t *testing.T, username string) *Client {
+	conn, peer := net.Pipe()
+	go io.Copy(io.Discard, peer)
+
+	client := NewClient(conn, username, nil)
+	t.Cleanup(func() {
+		client.Abort()
+		peer.Close()
+	})
+	return client
+}
+
+func TestRenameWhileAdminAndSaveRun(t *testing.T) {
+	// Запускать с -race: Rename меняет имена, пока админка
+	// и сохранение файла читают их из других горутин
+	quietLogger(t)
+
+	fs, err := NewFileStore(filepath.Join(t.TempDir(), "rooms.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	withStore(t, fs)
+
+	room := NewRoom("12345678", "alice", RoomSettings{Persistent: true})
+	alice := readingClient(t, "alice")
+	alice.Owner = true
+	room.Clients = append(room.Clients, alice)
+	if err := fs.Create(room); err != nil {
+		t.Fatal(err)
+	}
+
+	// Чётное число переименований: в конце alice снова alice
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		names := []string{"alice2", "alice"}
+		for i := 0; i < 1000; i++ {
+			if _, err := room.Rename(alice, names[i%2]); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+
+	for i := 0; ; i++ {
+		select {
+		case <-done:
+		default:
+			adminListRooms()
+			adminListClients([]*Room{room})
+			adminKick(room.Code, "nobody")
+			if i%50 == 49 {
+				if err := fs.save(); err != nil {
+					t.Error(err)
+				}
+			}
+			continue
+		}
+		break
+	}
+
+	if got := room.OwnerName(); got != "alice" {
+		t.Errorf("owner is %q after renaming back, want alice", got)
+	}
+}
@@ -0,0 +1,366 @@
+package main
+
+// ============================================================
+// WEBSOCKET ШЛЮЗ
+// ============================================================
+//
+// Браузер не умеет в сырой TCP, поэтому сервер дополнительно слушает
+// WebSocket (RFC 6455). Каждое бинарное WS-сообщение несёт ровно один
+// фрейм протокола — те же байты, что идут по TCP (см. PROTOCOL.md).
+//
+// wsConn реализует net.Conn, поэтому дальше работает обычный
+// handleClient: WebSocket-клиент и терминальный клиент попадают
+// в одни и те же комнаты и получают один и тот же Broadcast.
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"messenger-protocol"
+)
+
+// websocketGUID — магическая строка из RFC 6455 для Sec-WebSocket-Accept
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// Опкоды WebSocket
+const (
+	wsOpContinuation = 0x0
+	wsOpText         = 0x1
+	wsOpBinary       = 0x2
+	wsOpClose        = 0x8
+	wsOpPing         = 0x9
+	wsOpPong         = 0xA
+)
+
+// wsHeaderTimeout — сколько ждать HTTP-заголовков upgrade-запроса.
+// Без него медленный клиент (slowloris) держал бы соединение вечно:
+// дедлайны handleClient начинают действовать только после upgrade.
+const wsHeaderTimeout = 10 * time.Second
+
+// serveWebSocket запускает HTTP-сервер с эндпоинтом /ws
+// Если tlsConfig задан — работает как wss://
+func serveWebSocket(listener net.Listener, tlsConfig *tls.Config) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ws", handleWebSocket)
+
+	server := &http.Server{
+		Handler:           mux,
+		TLSConfig:         tlsConfig,
+		ReadHeaderTimeout: wsHeaderTimeout,
+	}
+
+	if tlsConfig != nil {
+		// Сертификат уже лежит в tlsConfig, поэтому пути пустые
+		return server.ServeTLS(listener, "", "")
+	}
+	return server.Serve(listener)
+}
+
+// handleWebSocket делает upgrade HTTP → WebSocket и передаёт
+// соединение в handleClient
+func handleWebSocket(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet ||
+		!headerContains(r.Header, "Connection", "upgrade") ||
+		!headerContains(r.Header, "Upgrade", "websocket") {
+		http.Error(w, "WebSocket upgrade required", http.StatusUpgradeRequired)
+		return
+	}
+
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "Unsupported WebSocket version", http.StatusUpgradeRequired)
+		return
+	}
+
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if key == "" {
+		http.Error(w, "Missing Sec-WebSocket-Key", http.StatusBadRequest)
+		return
+	}
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "WebSocket not supported", http.StatusInternalServerError)
+		return
+	}
+
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		logger.Warn("websocket_hijack_failed", "remote_addr", r.RemoteAddr, "error", err)
+		return
+	}
+
+	// Ответ 101 — дальше по соединению идут WS-фреймы
+	response := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + websocketAccept(key) + "\r\n\r\n"
+	if _, err := conn.Write([]byte(response)); err != nil {
+		conn.Close()
+		return
+	}
+
+	logger.Debug("websocket_connected", "remote_addr", conn.RemoteAddr())
+
+	// Дальше всё как у обычного TCP-клиента
+	handleClient(&wsConn{Conn: conn, reader: rw.Reader})
+}
+
+// websocketAccept вычисляет Sec-WebSocket-Accept из ключа клиента
+func websocketAccept(key string) string {
+	sum := sha1.Sum([]byte(key + websocketGUID))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// headerContains проверяет что заголовок содержит токен (без учёта регистра)
+// Например "Connection: keep-alive, Upgrade"
+func headerContains(h http.Header, name, token string) bool {
+	for _, value := range h.Values(name) {
+		for _, part := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(part), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ============================================================
+// wsConn — WebSocket как net.Conn
+// ============================================================
+
+// wsConn превращает поток WS-сообщений в поток байтов
+//
+// Read отдаёт содержимое бинарных сообщений подряд,
+// Write отправляет каждый вызов отдельным бинарным сообщением
+// (protocol.WriteFrame пишет фрейм одним вызовом Write).
+type wsConn struct {
+	net.Conn               // сырое соединение (адреса, дедлайны)
+	reader   *bufio.Reader // буфер, оставшийся после HTTP
+	pending  []byte        // непрочитанный остаток текущего сообщения
+	writeMu  sync.Mutex    // ответы на ping пишутся из Read
+	closed   bool
+}
+
+// Read читает байты из бинарных сообщений
+func (c *wsConn) Read(p []byte) (int, error) {
+	for len(c.pending) == 0 {
+		message, err := c.readMessage()
+		if err != nil {
+			return 0, err
+		}
+		c.pending = message
+	}
+
+	n := copy(p, c.pending)
+	c.pending = c.pending[n:]
+	return n, nil
+}
+
+// Write отправляет p одним бинарным сообщением
+func (c *wsConn) Write(p []byte) (int, error) {
+	if err := c.writeFrame(wsOpBinary, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Close отправляет close-фрейм и закрывает соединение
+func (c *wsConn) Close() error {
+	c.writeMu.Lock()
+	alreadyClosed := c.closed
+	c.closed = true
+	c.writeMu.Unlock()
+
+	if !alreadyClosed {
+		c.writeFrame(wsOpClose, nil)
+	}
+	return c.Conn.Close()
+}
+
+// Abort закрывает соединение без close-фрейма и без writeMu
+//
+// Писатель может висеть в Write с захваченным writeMu до writeTimeout;
+// закрытый сокет прерывает его сразу.
+func (c *wsConn) Abort() error {
+	return c.Conn.Close()
+}
+
+// readMessage собирает одно сообщение (с учётом фрагментации)
+// Управляющие фреймы (ping/pong/close) обрабатываются по пути
+//
+// Сообщение — ровно один фрейм протокола. Поэтому сначала читаются
+// только его 6 байт заголовка, и лимит типа (frameLimit) проверяется
+// до того, как прочитать (и выделить память под) всё остальное.
+func (c *wsConn) readMessage() ([]byte, error) {
+	var message []byte
+	size := -1 // длина сообщения по заголовку протокола (-1 — ещё не прочитан)
+
+	for {
+		h, err := c.readHeader()
+		if err != nil {
+			return nil, err
+		}
+
+		switch h.opcode {
+		case wsOpPing, wsOpPong, wsOpClose:
+			// Управляющие фреймы короткие и не фрагментируются (RFC 6455, 5.5)
+			if h.length > 125 || !h.fin {
+				return nil, errors.New("websocket: invalid control frame")
+			}
+			payload, err := c.readPayload(nil, h, h.length)
+			if err != nil {
+				return nil, err
+			}
+			if h.opcode == wsOpPing {
+				if err := c.writeFrame(wsOpPong, payload); err != nil {
+					return nil, err
+				}
+			}
+			if h.opcode == wsOpClose {
+				return nil, io.EOF
+			}
+			continue
+		case wsOpText:
+			return nil, errors.New("websocket: text messages are not supported, use binary")
+		}
+
+		// Дочитываем заголовок фрейма протокола и проверяем лимит его типа
+		if size < 0 {
+			n := uint64(protocol.HeaderSize - len(message))
+			if n > h.length {
+				n = h.length
+			}
+			if message, err = c.readPayload(message, h, n); err != nil {
+				return nil, err
+			}
+
+			if len(message) == protocol.HeaderSize {
+				t := protocol.Type(message[1])
+				length := binary.BigEndian.Uint32(message[2:])
+				if limit := frameLimit(t); uint64(length) > uint64(limit) {
+					return nil, &protocol.FrameTooLargeError{Type: t, Length: int(length), Limit: limit}
+				}
+				size = protocol.HeaderSize + int(length)
+			}
+		}
+
+		rest := h.length - h.read
+		if rest > 0 && (size < 0 || uint64(len(message))+rest > uint64(size)) {
+			return nil, errWSMessage
+		}
+		if message, err = c.readPayload(message, h, rest); err != nil {
+			return nil, err
+		}
+
+		if h.fin {
+			if len(message) != size {
+				return nil, errWSMessage
+			}
+			return message, nil
+		}
+	}
+}
+
+// errWSMessage — сообщение длиннее или короче своего фрейма протокола
+var errWSMessage = errors.New("websocket: message must carry exactly one protocol frame")
+
+// wsHeader — заголовок одного WS-фрейма
+type wsHeader struct {
+	fin    bool
+	opcode byte
+	length uint64
+	mask   [4]byte
+	read   uint64 // сколько байт payload уже прочитано (для маски)
+}
+
+// readHeader читает заголовок WS-фрейма, но не payload
+//
+//	[FIN|RSV|opcode][MASK|len7][ext len 16/64][mask key 4][payload]
+func (c *wsConn) readHeader() (*wsHeader, error) {
+	var header [2]byte
+	if _, err := io.ReadFull(c.reader, header[:]); err != nil {
+		return nil, err
+	}
+
+	h := &wsHeader{
+		fin:    header[0]&0x80 != 0,
+		opcode: header[0] & 0x0F,
+		length: uint64(header[1] & 0x7F),
+	}
+	masked := header[1]&0x80 != 0
+
+	switch h.length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.reader, ext[:]); err != nil {
+			return nil, err
+		}
+		h.length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.reader, ext[:]); err != nil {
+			return nil, err
+		}
+		h.length = binary.BigEndian.Uint64(ext[:])
+	}
+
+	// Клиент обязан маскировать фреймы (RFC 6455, 5.1)
+	if !masked {
+		return nil, errors.New("websocket: unmasked client frame")
+	}
+
+	if _, err := io.ReadFull(c.reader, h.mask[:]); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// readPayload дочитывает n байт payload фрейма h в конец buf
+// (размер уже проверен вызывающим)
+func (c *wsConn) readPayload(buf []byte, h *wsHeader, n uint64) ([]byte, error) {
+	start := len(buf)
+	buf = append(buf, make([]byte, n)...)
+	if _, err := io.ReadFull(c.reader, buf[start:]); err != nil {
+		return nil, err
+	}
+
+	for i := range buf[start:] {
+		buf[start+i] ^= h.mask[(h.read+uint64(i))%4]
+	}
+	h.read += n
+	return buf, nil
+}
+
+// writeFrame отправляет один WS-фрейм (сервер не маскирует)
+func (c *wsConn) writeFrame(opcode byte, payload []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	header := make([]byte, 0, 10)
+	header = append(header, 0x80|opcode) // FIN + opcode
+
+	switch {
+	case len(payload) < 126:
+		header = append(header, byte(len(payload)))
+	case len(payload) <= 0xFFFF:
+		header = append(header, 126, 0, 0)
+		binary.BigEndian.PutUint16(header[2:], uint16(len(payload)))
+	default:
+		header = append(header, 127, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(header[2:], uint64(len(payload)))
+	}
+
+	_, err := c.Conn.Write(append(header, payload...))
+	return err
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"testing"
+
+	"messenger-protocol"
+)
+
+// wsClientFrame собирает замаскированный WS-фрейм, как его шлёт браузер
+// length — длина в заголовке (может не совпадать с len(payload))
+func wsClientFrame(fin bool, opcode byte, payload []byte, length uint64) []byte {
+	first := opcode
+	if fin {
+		first |= 0x80
+	}
+	frame := []byte{first}
+
+	switch {
+	case length < 126:
+		frame = append(frame, 0x80|byte(length))
+	case length <= 0xFFFF:
+		frame = append(frame, 0x80|126, byte(length>>8), byte(length))
+	default:
+		frame = append(frame, 0x80|127, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(frame[2:], length)
+	}
+
+	mask := []byte{0x12, 0x34, 0x56, 0x78}
+	frame = append(frame, mask...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+	return frame
+}
+
+// protoFrame — фрейм протокола с заданной длиной в заголовке
+func protoFrame(t protocol.Type, length uint32, payload []byte) []byte {
+	frame := []byte{protocol.Version, byte(t), 0, 0, 0, 0}
+	binary.BigEndian.PutUint32(frame[2:], length)
+	return append(frame, payload...)
+}
+
+// readWS отдаёт байты wsConn на другом конце трубы и возвращает
+// результат readMessage; ответы сервера (pong) копятся в replies
+func readWS(input []byte) (message, replies []byte, err error) {
+	server, client := net.Pipe()
+	defer server.Close()
+
+	var out bytes.Buffer
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		io.Copy(&out, client)
+	}()
+	go func() {
+		// Ошибка записи значит, что сервер перестал читать — так и задумано
+		client.Write(input)
+	}()
+
+	conn := &wsConn{Conn: server, reader: bufio.NewReader(server)}
+	message, err = conn.readMessage()
+
+	server.Close()
+	client.Close()
+	<-done
+	return message, out.Bytes(), err
+}
+
+func TestWSReadMessage(t *testing.T) {
+	chat := protoFrame(protocol.TypeChat, 13, []byte(`{"body":"hi"}`))
+
+	tests := []struct {
+		name    string
+		input   []byte
+		want    []byte
+		wantErr bool
+		is      error // если задано — какая именно ошибка
+	}{
+		{"one frame", wsClientFrame(true, wsOpBinary, chat, uint64(len(chat))), chat, false, nil},
+		{"fragmented inside the header", concat(
+			wsClientFrame(false, wsOpBinary, chat[:3], 3),
+			wsClientFrame(false, wsOpContinuation, chat[3:10], 7),
+			wsClientFrame(true, wsOpContinuation, chat[10:], uint64(len(chat)-10)),
+		), chat, false, nil},
+		{"ping in the middle", concat(
+			wsClientFrame(false, wsOpBinary, chat[:8], 8),
+			wsClientFrame(true, wsOpPing, []byte("ok"), 2),
+			wsClientFrame(true, wsOpContinuation, chat[8:], uint64(len(chat)-8)),
+		), chat, false, nil},
+		{"close", wsClientFrame(true, wsOpClose, nil, 0), nil, true, io.EOF},
+		{"text", wsClientFrame(true, wsOpText, []byte("hi"), 2), nil, true, nil},
+		{"longer than its frame", wsClientFrame(true, wsOpBinary, append(chat, 'x'), uint64(len(chat)+1)), nil, true, errWSMessage},
+		{"shorter than its frame", wsClientFrame(true, wsOpBinary, chat[:10], 10), nil, true, errWSMessage},
+		{"only part of the header", wsClientFrame(true, wsOpBinary, chat[:4], 4), nil, true, errWSMessage},
+		{"control frame too long", wsClientFrame(true, wsOpPing, make([]byte, 126), 126), nil, true, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			message, _, err := readWS(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("readMessage() error = %v, want error: %v", err, tt.wantErr)
+			}
+			if tt.is != nil && !errors.Is(err, tt.is) {
+				t.Fatalf("readMessage() error = %v, want %v", err, tt.is)
+			}
+			if !bytes.Equal(message, tt.want) {
+				t.Errorf("readMessage() = %q, want %q", message, tt.want)
+			}
+		})
+	}
+}
+
+func TestWSPingAnswered(t *testing.T) {
+	chat := protoFrame(protocol.TypeChat, 2, []byte(`{}`))
+	input := concat(
+		wsClientFrame(true, wsOpPing, []byte("ok"), 2),
+		wsClientFrame(true, wsOpBinary, chat, uint64(len(chat))),
+	)
+
+	_, replies, err := readWS(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []byte{0x80 | wsOpPong, 2, 'o', 'k'}; !bytes.Equal(replies, want) {
+		t.Errorf("reply = %v, want pong %v", replies, want)
+	}
+}
+
+func TestWSFrameLimitBeforePayload(t *testing.T) {
+	tests := []struct {
+		t      protocol.Type
+		length uint32
+	}{
+		{protocol.TypeChat, uint32(frameLimit(protocol.TypeChat) + 1)},
+		{protocol.TypeWho, uint32(frameLimit(protocol.TypeWho) + 1)},
+		{protocol.TypePing, uint32(frameLimit(protocol.TypePing) + 1)},
+		{protocol.TypeChat, 1 << 30},
+	}
+
+	for _, tt := range tests {
+		// WS-фрейм обещает весь payload, но приходит только заголовок
+		// протокола: лимит должен сработать, не дожидаясь остального
+		header := protoFrame(tt.t, tt.length, nil)
+		input := wsClientFrame(true, wsOpBinary, header, uint64(len(header))+uint64(tt.length))
+
+		_, _, err := readWS(input)
+
+		var tooLarge *protocol.FrameTooLargeError
+		if !errors.As(err, &tooLarge) {
+			t.Errorf("%s with %d bytes: error = %v, want FrameTooLargeError", tt.t, tt.length, err)
+			continue
+		}
+		if tooLarge.Type != tt.t || tooLarge.Length != int(tt.length) || tooLarge.Limit != frameLimit(tt.t) {
+			t.Errorf("%s with %d bytes: got %+v", tt.t, tt.length, tooLarge)
+		}
+	}
+}
+
+// concat склеивает WS-фреймы в один поток
+func concat(parts ...[]byte) []byte {
+	return bytes.Join(parts, nil)
+}